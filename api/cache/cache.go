@@ -0,0 +1,38 @@
+// Package cache provides the response cache used by the model services.
+//
+// Values are stored as encoded bytes behind the Cache interface so an
+// in-process LRU can be swapped for a shared cache when running several
+// replicas.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache stores encoded values with a time-to-live
+type Cache interface {
+	// Get returns the value for key, or false if it is missing or expired
+	Get(ctx context.Context, key string) ([]byte, bool)
+	// Set stores value under key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration)
+	// Delete removes the given keys
+	Delete(ctx context.Context, keys ...string)
+	// DeletePrefix removes every key starting with prefix
+	DeletePrefix(ctx context.Context, prefix string)
+}
+
+// Noop is a Cache that stores nothing, used when caching is disabled
+type Noop struct{}
+
+// Get always misses
+func (Noop) Get(context.Context, string) ([]byte, bool) { return nil, false }
+
+// Set discards the value
+func (Noop) Set(context.Context, string, []byte, time.Duration) {}
+
+// Delete does nothing
+func (Noop) Delete(context.Context, ...string) {}
+
+// DeletePrefix does nothing
+func (Noop) DeletePrefix(context.Context, string) {}
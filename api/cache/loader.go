@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Loader reads through a Cache, collapsing concurrent misses for the same
+// key into a single load and refusing to store results that may have been
+// read before a concurrent invalidation
+type Loader struct {
+	cache Cache
+	group singleflight.Group
+	// epoch changes on every invalidation
+	epoch atomic.Uint64
+}
+
+// NewLoader creates a Loader backed by c
+func NewLoader(c Cache) *Loader {
+	return &Loader{cache: c}
+}
+
+// Invalidate removes keys from the cache
+func (l *Loader) Invalidate(ctx context.Context, keys ...string) {
+	l.epoch.Add(1)
+	l.cache.Delete(ctx, keys...)
+}
+
+// InvalidatePrefix removes every key starting with prefix
+func (l *Loader) InvalidatePrefix(ctx context.Context, prefix string) {
+	l.epoch.Add(1)
+	l.cache.DeletePrefix(ctx, prefix)
+}
+
+// Load returns the cached value for key, or calls load, caches its result
+// for ttl and returns it. Errors are never cached.
+func Load[T any](ctx context.Context, l *Loader, key string, ttl time.Duration, load func(context.Context) (T, error)) (T, error) {
+	var value T
+	if data, ok := l.cache.Get(ctx, key); ok {
+		if err := json.Unmarshal(data, &value); err == nil {
+			return value, nil
+		}
+	}
+
+	// The shared load must outlive any single caller's cancellation
+	data, err, _ := l.group.Do(key, func() (any, error) {
+		epoch := l.epoch.Load()
+		loaded, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(loaded)
+		if err != nil {
+			return nil, err
+		}
+
+		if l.epoch.Load() == epoch {
+			l.cache.Set(ctx, key, data, ttl)
+		}
+		return data, nil
+	})
+	if err != nil {
+		return value, err
+	}
+
+	// Decode per caller so no two callers share mutable state
+	err = json.Unmarshal(data.([]byte), &value)
+	return value, err
+}
@@ -0,0 +1,404 @@
+// Package config loads and validates the API's runtime configuration.
+//
+// Settings are resolved in order of increasing precedence: built-in
+// defaults, an optional YAML or TOML config file, environment variables
+// (including those loaded from the env file), and command-line flags.
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Config holds every setting the API needs at startup
+type Config struct {
+	// ConfigFile is the YAML or TOML file settings were read from, if any
+	ConfigFile string
+	// EnvFile is the dotenv file loaded into the environment, if present
+	EnvFile string
+
+	Server   ServerConfig
+	Database DatabaseConfig
+	Health   HealthConfig
+	CORS     CORSConfig
+	Log      LogConfig
+	Metrics  MetricsConfig
+	Tracing  TracingConfig
+	// HTTPCache holds Cache-Control policies for public read endpoints
+	HTTPCache HTTPCacheConfig
+	// Cache configures the server-side response cache
+	Cache CacheConfig
+	// Idempotency configures replay of retried create requests
+	Idempotency IdempotencyConfig
+	// Trash configures how long deleted posts can be restored
+	Trash TrashConfig
+	// Site holds settings describing the blog itself
+	Site SiteConfig
+	// Media configures uploads and where their files are stored
+	Media MediaConfig
+}
+
+// ServerConfig configures the HTTP server
+type ServerConfig struct {
+	Port              int
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	ShutdownTimeout   time.Duration
+}
+
+// DatabaseConfig configures the PostgreSQL connection pool
+type DatabaseConfig struct {
+	URL             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// HealthConfig configures the readiness probe
+type HealthConfig struct {
+	ReadinessTimeout time.Duration
+}
+
+// CORSConfig configures cross-origin access for browser clients
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// LogConfig configures structured logging
+type LogConfig struct {
+	// Format is "text" or "json"
+	Format string
+	// Level is the minimum level for packages without an override
+	Level string
+	// Levels holds per-package overrides such as "models=debug"
+	Levels []string
+}
+
+// MetricsConfig configures the Prometheus endpoint
+type MetricsConfig struct {
+	Enabled bool
+	Path    string
+}
+
+// TracingConfig configures OpenTelemetry tracing
+type TracingConfig struct {
+	// Exporter is "none", "stdout" or "otlp"
+	Exporter string
+	// Endpoint is the OTLP/HTTP URL; empty uses OTEL_EXPORTER_OTLP_* variables
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+}
+
+// HTTPCacheConfig sets the Cache-Control header sent by each read route
+type HTTPCacheConfig struct {
+	// PostList applies to GET /api/posts
+	PostList string
+	// Post applies to published posts from GET /api/posts/slug/:slug
+	Post string
+	// Draft applies to unpublished posts, which shared caches must not keep,
+	// and to GET /api/posts/:id, which editors load
+	Draft string
+	// Tags applies to GET /api/tags
+	Tags string
+	// Categories applies to GET /api/categories
+	Categories string
+	// Related applies to GET /api/posts/:id/related
+	Related string
+	// Authors applies to GET /api/authors and GET /api/authors/:id
+	Authors string
+	// Series applies to GET /api/series/slug/:slug
+	Series string
+	// Category applies to GET /api/categories/slug/:slug
+	Category string
+	// Tag applies to GET /api/tags/slug/:slug
+	Tag string
+	// Archive applies to GET /api/archive and GET /api/archive/:year/:month
+	Archive string
+}
+
+// CacheConfig configures the in-process response cache
+type CacheConfig struct {
+	Enabled    bool
+	MaxEntries int
+	MaxBytes   int
+	// PostTTL applies to single posts fetched by slug
+	PostTTL time.Duration
+	// ListTTL applies to pages of the post list
+	ListTTL time.Duration
+	// TagsTTL applies to the tag list
+	TagsTTL time.Duration
+	// CategoriesTTL applies to the category tree
+	CategoriesTTL time.Duration
+	// RelatedTTL applies to the related posts of a post
+	RelatedTTL time.Duration
+}
+
+// IdempotencyConfig controls how long Idempotency-Key responses are kept
+type IdempotencyConfig struct {
+	// TTL is how long a stored response is replayed for the same key
+	TTL time.Duration
+	// Lease is how long a key stays claimed by a request that has not
+	// finished; a retry takes over a claim older than this
+	Lease time.Duration
+	// PurgeInterval is how often expired keys are deleted
+	PurgeInterval time.Duration
+}
+
+// TrashConfig controls the automatic purge of deleted posts
+type TrashConfig struct {
+	// Retention is how long a deleted post stays in the trash
+	Retention time.Duration
+	// PurgeInterval is how often expired posts are purged
+	PurgeInterval time.Duration
+}
+
+// SiteConfig describes the blog itself
+type SiteConfig struct {
+	// TimeZone is the IANA zone posts are dated in, e.g. for the archive
+	TimeZone string
+}
+
+// MediaConfig configures media uploads
+type MediaConfig struct {
+	// Storage is where uploaded files are kept: local or s3
+	Storage string
+	// MaxBytes caps the size of a single upload
+	MaxBytes int
+	// BaseURL is the URL local files are served under; a path such as
+	// /media is served by the API itself
+	BaseURL string
+	// LocalDir is the directory local files are written to
+	LocalDir string
+	// S3Endpoint, S3Region, S3Bucket and the keys locate an S3-compatible
+	// bucket; S3PublicURL, e.g. a CDN, defaults to the bucket's URL
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PublicURL string
+}
+
+// Default returns the configuration used when nothing overrides it
+func Default() *Config {
+	return &Config{
+		EnvFile: ".env.local",
+		Server: ServerConfig{
+			Port:              8080,
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   25 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Health: HealthConfig{
+			ReadinessTimeout: 2 * time.Second,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   []string{"http://localhost:5173"},
+			AllowedHeaders:   []string{"Origin", "Content-Type", "Accept", "Authorization", "X-CSRF-Token", "X-Request-ID", "traceparent", "tracestate", "If-None-Match", "If-Modified-Since", "If-Match", "Idempotency-Key"},
+			ExposedHeaders:   []string{"X-Request-ID", "ETag", "Idempotent-Replayed"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		},
+		Log: LogConfig{
+			Format: "text",
+			Level:  "info",
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+			Path:    "/metrics",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "blog-api",
+			SampleRatio: 1,
+		},
+		HTTPCache: HTTPCacheConfig{
+			PostList:   "public, max-age=60, stale-while-revalidate=300",
+			Post:       "public, max-age=300, stale-while-revalidate=3600",
+			Draft:      "private, no-cache",
+			Tags:       "public, max-age=300, stale-while-revalidate=3600",
+			Categories: "public, max-age=300, stale-while-revalidate=3600",
+			Related:    "public, max-age=60, stale-while-revalidate=300",
+			Authors:    "public, max-age=60, stale-while-revalidate=300",
+			Series:     "public, max-age=60, stale-while-revalidate=300",
+			Category:   "public, max-age=60, stale-while-revalidate=300",
+			Tag:        "public, max-age=60, stale-while-revalidate=300",
+			Archive:    "public, max-age=60, stale-while-revalidate=300",
+		},
+		Cache: CacheConfig{
+			Enabled:       true,
+			MaxEntries:    1000,
+			MaxBytes:      64 << 20,
+			PostTTL:       5 * time.Minute,
+			ListTTL:       time.Minute,
+			TagsTTL:       5 * time.Minute,
+			CategoriesTTL: 5 * time.Minute,
+			RelatedTTL:    15 * time.Minute,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:           24 * time.Hour,
+			Lease:         time.Minute,
+			PurgeInterval: time.Hour,
+		},
+		Trash: TrashConfig{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Site: SiteConfig{
+			TimeZone: "UTC",
+		},
+		Media: MediaConfig{
+			Storage:  "local",
+			MaxBytes: 10 << 20,
+			BaseURL:  "/media",
+			LocalDir: "uploads",
+			S3Region: "us-east-1",
+		},
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535,
+		"server.port: must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout: must be positive")
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout: must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout: must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout: must be positive")
+	check(c.Server.MaxHeaderBytes >= 4096,
+		"server.max_header_bytes: must be at least 4096, got %d", c.Server.MaxHeaderBytes)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+
+	check(c.Database.URL != "",
+		"database.url: required; set NEON_DATABASE_URL, VITE_NEON_DATABASE_URL, --database-url or database.url in the config file")
+	check(c.Database.URL == "" || strings.HasPrefix(c.Database.URL, "postgres://") || strings.HasPrefix(c.Database.URL, "postgresql://"),
+		"database.url: must be a postgres:// or postgresql:// URL")
+	check(c.Database.MaxOpenConns > 0,
+		"database.max_open_conns: must be positive, got %d", c.Database.MaxOpenConns)
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns: must be between 0 and database.max_open_conns (%d), got %d",
+		c.Database.MaxOpenConns, c.Database.MaxIdleConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime: must not be negative")
+
+	check(c.Health.ReadinessTimeout > 0, "health.readiness_timeout: must be positive")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			check(!c.CORS.AllowCredentials,
+				"cors.allowed_origins: \"*\" cannot be combined with cors.allow_credentials; list origins explicitly")
+			continue
+		}
+		scheme, host, ok := strings.Cut(origin, "://")
+		check(ok && (scheme == "http" || scheme == "https") && host != "" && !strings.Contains(strings.TrimPrefix(host, "*."), "*"),
+			"cors.allowed_origins: %q must look like https://example.com or https://*.example.com", origin)
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max_age: must not be negative")
+
+	check(c.Log.Format == "text" || c.Log.Format == "json",
+		"log.format: must be \"text\" or \"json\", got %q", c.Log.Format)
+	check(validLevel(c.Log.Level), "log.level: %q is not one of debug, info, warn, error", c.Log.Level)
+	for _, entry := range c.Log.Levels {
+		component, level, ok := strings.Cut(entry, "=")
+		check(ok && strings.TrimSpace(component) != "" && validLevel(level),
+			"log.levels: %q must look like package=level, e.g. models=debug", entry)
+	}
+
+	check(!c.Metrics.Enabled || (strings.HasPrefix(c.Metrics.Path, "/") && !strings.HasPrefix(c.Metrics.Path, "/api/")),
+		"metrics.path: must start with / and not collide with /api/, got %q", c.Metrics.Path)
+
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "stdout" || c.Tracing.Exporter == "otlp",
+		"tracing.exporter: must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	check(c.Tracing.Endpoint == "" || strings.HasPrefix(c.Tracing.Endpoint, "http://") || strings.HasPrefix(c.Tracing.Endpoint, "https://"),
+		"tracing.endpoint: must be an http:// or https:// URL, got %q", c.Tracing.Endpoint)
+	check(c.Tracing.ServiceName != "", "tracing.service_name: required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1,
+		"tracing.sample_ratio: must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+
+	if c.Cache.Enabled {
+		check(c.Cache.MaxEntries > 0, "cache.max_entries: must be positive, got %d", c.Cache.MaxEntries)
+		check(c.Cache.MaxBytes > 0, "cache.max_bytes: must be positive, got %d", c.Cache.MaxBytes)
+		check(c.Cache.PostTTL > 0, "cache.post_ttl: must be positive")
+		check(c.Cache.ListTTL > 0, "cache.list_ttl: must be positive")
+		check(c.Cache.TagsTTL > 0, "cache.tags_ttl: must be positive")
+		check(c.Cache.CategoriesTTL > 0, "cache.categories_ttl: must be positive")
+		check(c.Cache.RelatedTTL > 0, "cache.related_ttl: must be positive")
+	}
+
+	check(c.Idempotency.TTL > 0, "idempotency.ttl: must be positive")
+	check(c.Idempotency.Lease > c.Server.WriteTimeout && c.Idempotency.Lease <= c.Idempotency.TTL,
+		"idempotency.lease: must be longer than server.write_timeout (%s) and at most idempotency.ttl (%s)",
+		c.Server.WriteTimeout, c.Idempotency.TTL)
+	check(c.Idempotency.PurgeInterval > 0, "idempotency.purge_interval: must be positive")
+
+	check(c.Trash.Retention > 0, "trash.retention: must be positive")
+	check(c.Trash.PurgeInterval > 0, "trash.purge_interval: must be positive")
+
+	_, err := time.LoadLocation(c.Site.TimeZone)
+	check(c.Site.TimeZone != "" && err == nil,
+		"site.time_zone: must be an IANA time zone such as Europe/Berlin, got %q", c.Site.TimeZone)
+
+	check(c.Media.Storage == "local" || c.Media.Storage == "s3",
+		"media.storage: must be local or s3, got %q", c.Media.Storage)
+	check(c.Media.MaxBytes > 0, "media.max_bytes: must be positive, got %d", c.Media.MaxBytes)
+	switch c.Media.Storage {
+	case "local":
+		check(c.Media.LocalDir != "", "media.local_dir: required when media.storage is local")
+		check(strings.HasPrefix(c.Media.BaseURL, "/") && c.Media.BaseURL != "/" && !strings.HasPrefix(c.Media.BaseURL, "/api/"),
+			"media.base_url: must be a path starting with / that does not collide with /api/, got %q", c.Media.BaseURL)
+	case "s3":
+		check(strings.HasPrefix(c.Media.S3Endpoint, "http://") || strings.HasPrefix(c.Media.S3Endpoint, "https://"),
+			"media.s3_endpoint: must be an http:// or https:// URL when media.storage is s3, got %q", c.Media.S3Endpoint)
+		check(c.Media.S3Region != "", "media.s3_region: required when media.storage is s3")
+		check(c.Media.S3Bucket != "", "media.s3_bucket: required when media.storage is s3")
+		check(c.Media.S3AccessKey != "" && c.Media.S3SecretKey != "",
+			"media.s3_access_key and media.s3_secret_key: required when media.storage is s3")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// validLevel reports whether level names a log level
+func validLevel(level string) bool {
+	var l slog.Level
+	return l.UnmarshalText([]byte(level)) == nil
+}
+
+// String renders every setting, one per line, with secrets redacted
+func (c *Config) String() string {
+	var b strings.Builder
+	if c.ConfigFile != "" {
+		fmt.Fprintf(&b, "config_file = %s\n", c.ConfigFile)
+	}
+	for _, s := range settings {
+		fmt.Fprintf(&b, "%s = %s\n", s.key, s.display(c))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,492 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting describes one configuration value and every source that can set it
+type setting struct {
+	// key is the dotted path used in config files, e.g. "server.port"
+	key string
+	// env lists environment variables in order of preference
+	env []string
+	// usage is shown in --help output
+	usage string
+	// secret values are redacted when the configuration is printed
+	secret bool
+	// field returns a pointer to the value inside c
+	field func(c *Config) any
+}
+
+// settings lists every configurable value; flags are derived from keys,
+// so "server.read_timeout" becomes --server-read-timeout
+var settings = []setting{
+	{
+		key:   "server.port",
+		env:   []string{"PORT"},
+		usage: "port the HTTP server listens on",
+		field: func(c *Config) any { return &c.Server.Port },
+	},
+	{
+		key:   "server.read_timeout",
+		env:   []string{"HTTP_READ_TIMEOUT"},
+		usage: "maximum duration for reading an entire request",
+		field: func(c *Config) any { return &c.Server.ReadTimeout },
+	},
+	{
+		key:   "server.read_header_timeout",
+		env:   []string{"HTTP_READ_HEADER_TIMEOUT"},
+		usage: "maximum duration for reading request headers",
+		field: func(c *Config) any { return &c.Server.ReadHeaderTimeout },
+	},
+	{
+		key:   "server.write_timeout",
+		env:   []string{"HTTP_WRITE_TIMEOUT"},
+		usage: "maximum duration before timing out writes of a response",
+		field: func(c *Config) any { return &c.Server.WriteTimeout },
+	},
+	{
+		key:   "server.idle_timeout",
+		env:   []string{"HTTP_IDLE_TIMEOUT"},
+		usage: "maximum time to wait for the next request on a keep-alive connection",
+		field: func(c *Config) any { return &c.Server.IdleTimeout },
+	},
+	{
+		key:   "server.max_header_bytes",
+		env:   []string{"HTTP_MAX_HEADER_BYTES"},
+		usage: "maximum size of request headers in bytes",
+		field: func(c *Config) any { return &c.Server.MaxHeaderBytes },
+	},
+	{
+		key:   "server.shutdown_timeout",
+		env:   []string{"SHUTDOWN_TIMEOUT"},
+		usage: "how long to drain requests and workers on shutdown",
+		field: func(c *Config) any { return &c.Server.ShutdownTimeout },
+	},
+	{
+		key:    "database.url",
+		env:    []string{"NEON_DATABASE_URL", "VITE_NEON_DATABASE_URL"},
+		usage:  "PostgreSQL connection URL",
+		secret: true,
+		field:  func(c *Config) any { return &c.Database.URL },
+	},
+	{
+		key:   "database.max_open_conns",
+		env:   []string{"DATABASE_MAX_OPEN_CONNS"},
+		usage: "maximum number of open database connections",
+		field: func(c *Config) any { return &c.Database.MaxOpenConns },
+	},
+	{
+		key:   "database.max_idle_conns",
+		env:   []string{"DATABASE_MAX_IDLE_CONNS"},
+		usage: "maximum number of idle database connections",
+		field: func(c *Config) any { return &c.Database.MaxIdleConns },
+	},
+	{
+		key:   "database.conn_max_lifetime",
+		env:   []string{"DATABASE_CONN_MAX_LIFETIME"},
+		usage: "maximum lifetime of a database connection (0 keeps connections forever)",
+		field: func(c *Config) any { return &c.Database.ConnMaxLifetime },
+	},
+	{
+		key:   "health.readiness_timeout",
+		env:   []string{"READINESS_TIMEOUT"},
+		usage: "timeout for each readiness check",
+		field: func(c *Config) any { return &c.Health.ReadinessTimeout },
+	},
+	{
+		key:   "cors.allowed_origins",
+		env:   []string{"CORS_ALLOWED_ORIGINS"},
+		usage: "comma-separated origins allowed to call the API; supports https://*.example.com",
+		field: func(c *Config) any { return &c.CORS.AllowedOrigins },
+	},
+	{
+		key:   "cors.allowed_headers",
+		env:   []string{"CORS_ALLOWED_HEADERS"},
+		usage: "comma-separated request headers browsers may send",
+		field: func(c *Config) any { return &c.CORS.AllowedHeaders },
+	},
+	{
+		key:   "cors.exposed_headers",
+		env:   []string{"CORS_EXPOSED_HEADERS"},
+		usage: "comma-separated response headers browsers may read",
+		field: func(c *Config) any { return &c.CORS.ExposedHeaders },
+	},
+	{
+		key:   "cors.allow_credentials",
+		env:   []string{"CORS_ALLOW_CREDENTIALS"},
+		usage: "allow cookies and authorization headers on cross-origin requests",
+		field: func(c *Config) any { return &c.CORS.AllowCredentials },
+	},
+	{
+		key:   "cors.max_age",
+		env:   []string{"CORS_MAX_AGE"},
+		usage: "how long browsers may cache preflight responses",
+		field: func(c *Config) any { return &c.CORS.MaxAge },
+	},
+	{
+		key:   "log.format",
+		env:   []string{"LOG_FORMAT"},
+		usage: "log output format: text or json",
+		field: func(c *Config) any { return &c.Log.Format },
+	},
+	{
+		key:   "log.level",
+		env:   []string{"LOG_LEVEL"},
+		usage: "minimum log level: debug, info, warn or error",
+		field: func(c *Config) any { return &c.Log.Level },
+	},
+	{
+		key:   "log.levels",
+		env:   []string{"LOG_LEVELS"},
+		usage: "comma-separated per-package levels, e.g. models=debug,handlers=warn",
+		field: func(c *Config) any { return &c.Log.Levels },
+	},
+	{
+		key:   "metrics.enabled",
+		env:   []string{"METRICS_ENABLED"},
+		usage: "serve Prometheus metrics",
+		field: func(c *Config) any { return &c.Metrics.Enabled },
+	},
+	{
+		key:   "metrics.path",
+		env:   []string{"METRICS_PATH"},
+		usage: "path of the Prometheus metrics endpoint",
+		field: func(c *Config) any { return &c.Metrics.Path },
+	},
+	{
+		key:   "tracing.exporter",
+		env:   []string{"TRACING_EXPORTER"},
+		usage: "trace exporter: none, stdout or otlp",
+		field: func(c *Config) any { return &c.Tracing.Exporter },
+	},
+	{
+		key:   "tracing.endpoint",
+		env:   []string{"TRACING_ENDPOINT"},
+		usage: "OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces",
+		field: func(c *Config) any { return &c.Tracing.Endpoint },
+	},
+	{
+		key:   "tracing.service_name",
+		env:   []string{"OTEL_SERVICE_NAME"},
+		usage: "service name reported on spans",
+		field: func(c *Config) any { return &c.Tracing.ServiceName },
+	},
+	{
+		key:   "tracing.sample_ratio",
+		env:   []string{"TRACING_SAMPLE_RATIO"},
+		usage: "fraction of new traces to sample, between 0 and 1",
+		field: func(c *Config) any { return &c.Tracing.SampleRatio },
+	},
+	{
+		key:   "http_cache.post_list",
+		env:   []string{"CACHE_CONTROL_POST_LIST"},
+		usage: "Cache-Control header for GET /api/posts",
+		field: func(c *Config) any { return &c.HTTPCache.PostList },
+	},
+	{
+		key:   "http_cache.post",
+		env:   []string{"CACHE_CONTROL_POST"},
+		usage: "Cache-Control header for published posts from GET /api/posts/slug/:slug",
+		field: func(c *Config) any { return &c.HTTPCache.Post },
+	},
+	{
+		key:   "http_cache.draft",
+		env:   []string{"CACHE_CONTROL_DRAFT"},
+		usage: "Cache-Control header for unpublished posts and GET /api/posts/:id",
+		field: func(c *Config) any { return &c.HTTPCache.Draft },
+	},
+	{
+		key:   "http_cache.tags",
+		env:   []string{"CACHE_CONTROL_TAGS"},
+		usage: "Cache-Control header for GET /api/tags",
+		field: func(c *Config) any { return &c.HTTPCache.Tags },
+	},
+	{
+		key:   "http_cache.categories",
+		env:   []string{"CACHE_CONTROL_CATEGORIES"},
+		usage: "Cache-Control header for GET /api/categories",
+		field: func(c *Config) any { return &c.HTTPCache.Categories },
+	},
+	{
+		key:   "http_cache.related",
+		env:   []string{"CACHE_CONTROL_RELATED"},
+		usage: "Cache-Control header for GET /api/posts/:id/related",
+		field: func(c *Config) any { return &c.HTTPCache.Related },
+	},
+	{
+		key:   "http_cache.authors",
+		env:   []string{"CACHE_CONTROL_AUTHORS"},
+		usage: "Cache-Control header for GET /api/authors and GET /api/authors/:id",
+		field: func(c *Config) any { return &c.HTTPCache.Authors },
+	},
+	{
+		key:   "http_cache.series",
+		env:   []string{"CACHE_CONTROL_SERIES"},
+		usage: "Cache-Control header for GET /api/series/slug/:slug",
+		field: func(c *Config) any { return &c.HTTPCache.Series },
+	},
+	{
+		key:   "http_cache.category",
+		env:   []string{"CACHE_CONTROL_CATEGORY"},
+		usage: "Cache-Control header for GET /api/categories/slug/:slug",
+		field: func(c *Config) any { return &c.HTTPCache.Category },
+	},
+	{
+		key:   "http_cache.tag",
+		env:   []string{"CACHE_CONTROL_TAG"},
+		usage: "Cache-Control header for GET /api/tags/slug/:slug",
+		field: func(c *Config) any { return &c.HTTPCache.Tag },
+	},
+	{
+		key:   "http_cache.archive",
+		env:   []string{"CACHE_CONTROL_ARCHIVE"},
+		usage: "Cache-Control header for GET /api/archive and GET /api/archive/:year/:month",
+		field: func(c *Config) any { return &c.HTTPCache.Archive },
+	},
+	{
+		key:   "cache.enabled",
+		env:   []string{"CACHE_ENABLED"},
+		usage: "cache posts and tags in memory",
+		field: func(c *Config) any { return &c.Cache.Enabled },
+	},
+	{
+		key:   "cache.max_entries",
+		env:   []string{"CACHE_MAX_ENTRIES"},
+		usage: "maximum number of cached responses",
+		field: func(c *Config) any { return &c.Cache.MaxEntries },
+	},
+	{
+		key:   "cache.max_bytes",
+		env:   []string{"CACHE_MAX_BYTES"},
+		usage: "maximum total size of cached responses in bytes",
+		field: func(c *Config) any { return &c.Cache.MaxBytes },
+	},
+	{
+		key:   "cache.post_ttl",
+		env:   []string{"CACHE_POST_TTL"},
+		usage: "how long a post fetched by slug stays cached",
+		field: func(c *Config) any { return &c.Cache.PostTTL },
+	},
+	{
+		key:   "cache.list_ttl",
+		env:   []string{"CACHE_LIST_TTL"},
+		usage: "how long a page of posts stays cached",
+		field: func(c *Config) any { return &c.Cache.ListTTL },
+	},
+	{
+		key:   "cache.tags_ttl",
+		env:   []string{"CACHE_TAGS_TTL"},
+		usage: "how long the tag list stays cached",
+		field: func(c *Config) any { return &c.Cache.TagsTTL },
+	},
+	{
+		key:   "cache.categories_ttl",
+		env:   []string{"CACHE_CATEGORIES_TTL"},
+		usage: "how long the category tree stays cached",
+		field: func(c *Config) any { return &c.Cache.CategoriesTTL },
+	},
+	{
+		key:   "cache.related_ttl",
+		env:   []string{"CACHE_RELATED_TTL"},
+		usage: "how long a post's related posts stay cached",
+		field: func(c *Config) any { return &c.Cache.RelatedTTL },
+	},
+	{
+		key:   "idempotency.ttl",
+		env:   []string{"IDEMPOTENCY_TTL"},
+		usage: "how long a response is replayed for a repeated Idempotency-Key",
+		field: func(c *Config) any { return &c.Idempotency.TTL },
+	},
+	{
+		key:   "idempotency.lease",
+		env:   []string{"IDEMPOTENCY_LEASE"},
+		usage: "how long an unfinished request holds its Idempotency-Key before a retry may take it over",
+		field: func(c *Config) any { return &c.Idempotency.Lease },
+	},
+	{
+		key:   "idempotency.purge_interval",
+		env:   []string{"IDEMPOTENCY_PURGE_INTERVAL"},
+		usage: "how often expired idempotency keys are deleted",
+		field: func(c *Config) any { return &c.Idempotency.PurgeInterval },
+	},
+	{
+		key:   "trash.retention",
+		env:   []string{"TRASH_RETENTION"},
+		usage: "how long deleted posts can be restored before they are purged",
+		field: func(c *Config) any { return &c.Trash.Retention },
+	},
+	{
+		key:   "trash.purge_interval",
+		env:   []string{"TRASH_PURGE_INTERVAL"},
+		usage: "how often posts past trash.retention are purged",
+		field: func(c *Config) any { return &c.Trash.PurgeInterval },
+	},
+	{
+		key:   "site.time_zone",
+		env:   []string{"SITE_TIME_ZONE"},
+		usage: "IANA time zone posts are dated in, e.g. by the archive",
+		field: func(c *Config) any { return &c.Site.TimeZone },
+	},
+	{
+		key:   "media.storage",
+		env:   []string{"MEDIA_STORAGE"},
+		usage: "where uploaded media is stored: local or s3",
+		field: func(c *Config) any { return &c.Media.Storage },
+	},
+	{
+		key:   "media.max_bytes",
+		env:   []string{"MEDIA_MAX_BYTES"},
+		usage: "largest media upload accepted, in bytes",
+		field: func(c *Config) any { return &c.Media.MaxBytes },
+	},
+	{
+		key:   "media.base_url",
+		env:   []string{"MEDIA_BASE_URL"},
+		usage: "path local media files are served under",
+		field: func(c *Config) any { return &c.Media.BaseURL },
+	},
+	{
+		key:   "media.local_dir",
+		env:   []string{"MEDIA_LOCAL_DIR"},
+		usage: "directory local media files are written to",
+		field: func(c *Config) any { return &c.Media.LocalDir },
+	},
+	{
+		key:   "media.s3_endpoint",
+		env:   []string{"MEDIA_S3_ENDPOINT"},
+		usage: "URL of the S3-compatible service storing media",
+		field: func(c *Config) any { return &c.Media.S3Endpoint },
+	},
+	{
+		key:   "media.s3_region",
+		env:   []string{"MEDIA_S3_REGION"},
+		usage: "region of the media bucket",
+		field: func(c *Config) any { return &c.Media.S3Region },
+	},
+	{
+		key:   "media.s3_bucket",
+		env:   []string{"MEDIA_S3_BUCKET"},
+		usage: "bucket media files are stored in",
+		field: func(c *Config) any { return &c.Media.S3Bucket },
+	},
+	{
+		key:    "media.s3_access_key",
+		env:    []string{"MEDIA_S3_ACCESS_KEY"},
+		usage:  "access key for the media bucket",
+		secret: true,
+		field:  func(c *Config) any { return &c.Media.S3AccessKey },
+	},
+	{
+		key:    "media.s3_secret_key",
+		env:    []string{"MEDIA_S3_SECRET_KEY"},
+		usage:  "secret key for the media bucket",
+		secret: true,
+		field:  func(c *Config) any { return &c.Media.S3SecretKey },
+	},
+	{
+		key:   "media.s3_public_url",
+		env:   []string{"MEDIA_S3_PUBLIC_URL"},
+		usage: "public URL of stored media, e.g. a CDN; defaults to the bucket URL",
+		field: func(c *Config) any { return &c.Media.S3PublicURL },
+	},
+}
+
+// flagName derives the command-line flag name from the setting key
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+// set parses raw and stores it in c
+func (s setting) set(c *Config, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch p := s.field(c).(type) {
+	case *string:
+		*p = raw
+	case *int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", s.key, raw)
+		}
+		*p = n
+	case *float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", s.key, raw)
+		}
+		*p = f
+	case *bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", s.key, raw)
+		}
+		*p = b
+	case *time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration (e.g. 15s, 2m)", s.key, raw)
+		}
+		*p = d
+	case *[]string:
+		*p = nil
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+	default:
+		panic(fmt.Sprintf("config: unsupported type %T for %s", p, s.key))
+	}
+
+	return nil
+}
+
+// display renders the current value, redacting secrets
+func (s setting) display(c *Config) string {
+	var value string
+	switch p := s.field(c).(type) {
+	case *[]string:
+		value = strings.Join(*p, ",")
+	default:
+		value = fmt.Sprint(reflectValue(p))
+	}
+
+	if s.secret && value != "" {
+		return redact(value)
+	}
+	return value
+}
+
+// reflectValue dereferences a pointer returned by setting.field
+func reflectValue(p any) any {
+	switch v := p.(type) {
+	case *string:
+		return *v
+	case *int:
+		return *v
+	case *float64:
+		return *v
+	case *bool:
+		return *v
+	case *time.Duration:
+		return *v
+	}
+	return p
+}
+
+// redact hides a secret, keeping the host of URLs for troubleshooting
+func redact(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return "********"
+	}
+
+	// Drop the query string, which may carry credentials too
+	redacted := url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host, Path: u.Path}
+	return redacted.Redacted()
+}
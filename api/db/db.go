@@ -3,120 +3,52 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"log"
-	"os"
-	"sync"
+	"log/slog"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq" // PostgreSQL driver
-)
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 
-var (
-	db   *sql.DB
-	once sync.Once
+	"github.com/biboy/blog/api/config"
 )
 
-// GetDB returns a singleton database connection
-func GetDB() *sql.DB {
-	once.Do(func() {
-		// Get the database URL from environment variables
-		dbURL := os.Getenv("NEON_DATABASE_URL")
-		if dbURL == "" {
-			// Try with VITE_ prefix (as seen in .env.local)
-			dbURL = os.Getenv("VITE_NEON_DATABASE_URL")
-			if dbURL == "" {
-				log.Fatal("Database URL not found in environment variables")
-			}
-		}
-
-		var err error
-		db, err = sql.Open("postgres", dbURL)
-		if err != nil {
-			log.Fatal("Failed to connect to database: ", err)
-		}
-
-		// Test the connection
-		if err = db.Ping(); err != nil {
-			log.Fatal("Failed to ping database: ", err)
-		}
-
-		// Configure connection pool
-		db.SetMaxOpenConns(25)
-		db.SetMaxIdleConns(5)
-
-		log.Println("Successfully connected to Neon database")
-	})
-
-	return db
-}
-
-// InitSchema initializes database schema if not exists
-func InitSchema() error {
-	db := GetDB()
-
-	// Create posts table
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS posts (
-			id TEXT PRIMARY KEY,
-			title TEXT NOT NULL,
-			content TEXT NOT NULL,
-			excerpt TEXT NOT NULL,
-			slug TEXT UNIQUE NOT NULL,
-			published BOOLEAN NOT NULL DEFAULT false,
-			read_time INTEGER NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			author_id TEXT NOT NULL,
-			author_email TEXT NOT NULL,
-			author_name TEXT NOT NULL,
-			author_picture TEXT NOT NULL,
-			author_is_admin BOOLEAN NOT NULL DEFAULT false
-		)
-	`)
+// Connect opens and verifies a connection pool using cfg
+func Connect(cfg config.DatabaseConfig, logger *slog.Logger) (*sql.DB, error) {
+	// Wrap the driver so every statement gets a child span of the caller's trace
+	db, err := otelsql.Open("postgres", cfg.URL,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitConnPrepare:      true,
+			OmitRows:             true,
+			DisableErrSkip:       true,
+		}),
+	)
 	if err != nil {
-		return fmt.Errorf("failed to create posts table: %w", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Create tags table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS tags (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL UNIQUE
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create tags table: %w", err)
-	}
+	// Configure connection pool
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-	// Create post_tags junction table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS post_tags (
-			post_id TEXT REFERENCES posts(id) ON DELETE CASCADE,
-			tag_id TEXT REFERENCES tags(id) ON DELETE CASCADE,
-			PRIMARY KEY (post_id, tag_id)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create post_tags table: %w", err)
+	// Test the connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Create comments table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS comments (
-			id TEXT PRIMARY KEY,
-			content TEXT NOT NULL,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			post_id TEXT REFERENCES posts(id) ON DELETE CASCADE,
-			author_id TEXT NOT NULL,
-			author_email TEXT NOT NULL,
-			author_name TEXT NOT NULL,
-			author_picture TEXT NOT NULL,
-			author_is_admin BOOLEAN NOT NULL DEFAULT false
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create comments table: %w", err)
+	logger.Info("successfully connected to Neon database")
+	return db, nil
+}
+
+// InitSchema initializes database schema if not exists
+func InitSchema(db *sql.DB, logger *slog.Logger) error {
+	if err := migrate(db, logger); err != nil {
+		return err
 	}
 
-	log.Println("Database schema initialized")
+	logger.Info("database schema initialized", "version", LatestVersion())
 	return nil
 }
@@ -0,0 +1,458 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// migration is a single, ordered schema change
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations lists every schema change in the order it must be applied.
+// Append new entries to the end; never edit or reorder applied ones.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		sql: `
+			CREATE TABLE IF NOT EXISTS posts (
+				id TEXT PRIMARY KEY,
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				excerpt TEXT NOT NULL,
+				slug TEXT UNIQUE NOT NULL,
+				published BOOLEAN NOT NULL DEFAULT false,
+				read_time INTEGER NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				author_id TEXT NOT NULL,
+				author_email TEXT NOT NULL,
+				author_name TEXT NOT NULL,
+				author_picture TEXT NOT NULL,
+				author_is_admin BOOLEAN NOT NULL DEFAULT false
+			);
+
+			CREATE TABLE IF NOT EXISTS tags (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE
+			);
+
+			CREATE TABLE IF NOT EXISTS post_tags (
+				post_id TEXT REFERENCES posts(id) ON DELETE CASCADE,
+				tag_id TEXT REFERENCES tags(id) ON DELETE CASCADE,
+				PRIMARY KEY (post_id, tag_id)
+			);
+
+			CREATE TABLE IF NOT EXISTS comments (
+				id TEXT PRIMARY KEY,
+				content TEXT NOT NULL,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				post_id TEXT REFERENCES posts(id) ON DELETE CASCADE,
+				author_id TEXT NOT NULL,
+				author_email TEXT NOT NULL,
+				author_name TEXT NOT NULL,
+				author_picture TEXT NOT NULL,
+				author_is_admin BOOLEAN NOT NULL DEFAULT false
+			);
+		`,
+	},
+	{
+		version: 2,
+		name:    "post versions",
+		sql: `
+			ALTER TABLE posts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+		`,
+	},
+	{
+		version: 3,
+		name:    "idempotency keys",
+		sql: `
+			CREATE TABLE IF NOT EXISTS idempotency_keys (
+				user_id TEXT NOT NULL,
+				key TEXT NOT NULL,
+				request_hash TEXT NOT NULL,
+				status_code INTEGER,
+				response_body BYTEA,
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				PRIMARY KEY (user_id, key)
+			);
+
+			CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+		`,
+	},
+	{
+		version: 4,
+		name:    "post trash",
+		sql: `
+			ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+			CREATE INDEX IF NOT EXISTS posts_deleted_at_idx ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
+		`,
+	},
+	{
+		version: 5,
+		name:    "case-insensitive tags and aliases",
+		sql: `
+			-- Fold tags whose names differ only in case or whitespace into the oldest one
+			CREATE TEMPORARY TABLE tag_merges ON COMMIT DROP AS
+			SELECT id, first_value(id) OVER (
+				PARTITION BY lower(btrim(regexp_replace(name, '\s+', ' ', 'g')))
+				ORDER BY id
+			) AS keep_id
+			FROM tags;
+
+			INSERT INTO post_tags (post_id, tag_id)
+			SELECT pt.post_id, m.keep_id
+			FROM post_tags pt
+			JOIN tag_merges m ON m.id = pt.tag_id
+			WHERE m.id <> m.keep_id
+			ON CONFLICT DO NOTHING;
+
+			DELETE FROM tags t
+			USING tag_merges m
+			WHERE t.id = m.id AND m.id <> m.keep_id;
+
+			UPDATE tags SET name = btrim(regexp_replace(name, '\s+', ' ', 'g'));
+
+			ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_name_key;
+			CREATE UNIQUE INDEX IF NOT EXISTS tags_name_lower_key ON tags (lower(name));
+
+			-- Aliases are stored normalized and lower-cased
+			CREATE TABLE IF NOT EXISTS tag_aliases (
+				alias TEXT PRIMARY KEY,
+				tag_id TEXT NOT NULL REFERENCES tags(id) ON DELETE CASCADE
+			);
+
+			CREATE INDEX IF NOT EXISTS tag_aliases_tag_id_idx ON tag_aliases (tag_id);
+		`,
+	},
+	{
+		version: 6,
+		name:    "tag metadata",
+		sql: `
+			ALTER TABLE tags ADD COLUMN IF NOT EXISTS slug TEXT;
+			ALTER TABLE tags ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+			ALTER TABLE tags ADD COLUMN IF NOT EXISTS color TEXT NOT NULL DEFAULT '';
+
+			-- Derive slugs from names: the first tag for each slug keeps it
+			WITH bases AS (
+				SELECT id, COALESCE(NULLIF(btrim(regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'), '-'), ''), 'tag') AS base
+				FROM tags
+			),
+			numbered AS (
+				SELECT id, base, row_number() OVER (PARTITION BY base ORDER BY id) AS n
+				FROM bases
+			)
+			UPDATE tags t
+			SET slug = n.base
+			FROM numbered n
+			WHERE t.id = n.id AND n.n = 1;
+
+			-- The others get the smallest free number from 2, skipping slugs
+			-- other names already derive, such as "go-2" from "Go 2"
+			DO $$
+			DECLARE
+				t RECORD;
+				candidate TEXT;
+				n INTEGER;
+			BEGIN
+				FOR t IN
+					SELECT id, COALESCE(NULLIF(btrim(regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'), '-'), ''), 'tag') AS base
+					FROM tags
+					WHERE slug IS NULL
+					ORDER BY base, id
+				LOOP
+					n := 2;
+					candidate := t.base || '-' || n;
+					WHILE EXISTS (SELECT 1 FROM tags WHERE slug = candidate) LOOP
+						n := n + 1;
+						candidate := t.base || '-' || n;
+					END LOOP;
+					UPDATE tags SET slug = candidate WHERE id = t.id;
+				END LOOP;
+			END $$;
+
+			ALTER TABLE tags ALTER COLUMN slug SET NOT NULL;
+			ALTER TABLE tags ADD CONSTRAINT tags_slug_key UNIQUE (slug);
+		`,
+	},
+	{
+		version: 7,
+		name:    "categories",
+		sql: `
+			CREATE TABLE IF NOT EXISTS categories (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				slug TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				parent_id TEXT,
+				position INTEGER NOT NULL DEFAULT 0,
+				CONSTRAINT categories_slug_key UNIQUE (slug),
+				CONSTRAINT categories_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES categories(id) ON DELETE RESTRICT,
+				CONSTRAINT categories_not_own_parent CHECK (parent_id <> id)
+			);
+
+			CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id, position);
+
+			ALTER TABLE posts ADD COLUMN IF NOT EXISTS category_id TEXT REFERENCES categories(id) ON DELETE SET NULL;
+			CREATE INDEX IF NOT EXISTS posts_category_id_idx ON posts (category_id);
+		`,
+	},
+	{
+		version: 8,
+		name:    "series",
+		sql: `
+			CREATE TABLE IF NOT EXISTS series (
+				id TEXT PRIMARY KEY,
+				title TEXT NOT NULL,
+				slug TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+				CONSTRAINT series_slug_key UNIQUE (slug)
+			);
+
+			-- A post belongs to at most one series
+			CREATE TABLE IF NOT EXISTS series_posts (
+				series_id TEXT NOT NULL REFERENCES series(id) ON DELETE CASCADE,
+				post_id TEXT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				position INTEGER NOT NULL,
+				PRIMARY KEY (series_id, post_id),
+				CONSTRAINT series_posts_post_id_key UNIQUE (post_id),
+				CONSTRAINT series_posts_position_key UNIQUE (series_id, position)
+			);
+		`,
+	},
+	{
+		version: 9,
+		name:    "users",
+		sql: `
+			-- Users are keyed by their identity provider subject
+			CREATE TABLE IF NOT EXISTS users (
+				id TEXT PRIMARY KEY,
+				email TEXT NOT NULL,
+				name TEXT NOT NULL,
+				picture TEXT NOT NULL DEFAULT '',
+				is_admin BOOLEAN NOT NULL DEFAULT false,
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+
+			-- Backfill each author's most recently written profile, across
+			-- both posts and comments
+			INSERT INTO users (id, email, name, picture, is_admin, created_at, updated_at)
+			SELECT DISTINCT ON (author_id)
+				author_id, author_email, author_name, author_picture, author_is_admin,
+				min(written_at) OVER (PARTITION BY author_id), written_at
+			FROM (
+				SELECT author_id, author_email, author_name, author_picture, author_is_admin,
+					COALESCE(created_at, CURRENT_TIMESTAMP) AS written_at
+				FROM posts
+				UNION ALL
+				SELECT author_id, author_email, author_name, author_picture, author_is_admin,
+					COALESCE(created_at, CURRENT_TIMESTAMP) AS written_at
+				FROM comments
+			) authored
+			ORDER BY author_id, written_at DESC
+			ON CONFLICT (id) DO NOTHING;
+
+			ALTER TABLE posts
+				ADD CONSTRAINT posts_author_id_fkey FOREIGN KEY (author_id) REFERENCES users(id),
+				DROP COLUMN author_email,
+				DROP COLUMN author_name,
+				DROP COLUMN author_picture,
+				DROP COLUMN author_is_admin;
+			CREATE INDEX IF NOT EXISTS posts_author_id_idx ON posts (author_id);
+
+			ALTER TABLE comments
+				ADD CONSTRAINT comments_author_id_fkey FOREIGN KEY (author_id) REFERENCES users(id),
+				DROP COLUMN author_email,
+				DROP COLUMN author_name,
+				DROP COLUMN author_picture,
+				DROP COLUMN author_is_admin;
+			CREATE INDEX IF NOT EXISTS comments_author_id_idx ON comments (author_id);
+		`,
+	},
+	{
+		version: 10,
+		name:    "author profiles",
+		sql: `
+			ALTER TABLE users
+				ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT '',
+				ADD COLUMN IF NOT EXISTS links JSONB NOT NULL DEFAULT '{}';
+		`,
+	},
+	{
+		version: 11,
+		name:    "post co-authors",
+		sql: `
+			-- The post's own author_id stays its primary author
+			CREATE TABLE IF NOT EXISTS post_coauthors (
+				post_id TEXT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				user_id TEXT NOT NULL REFERENCES users(id),
+				position INTEGER NOT NULL,
+				role TEXT NOT NULL,
+				PRIMARY KEY (post_id, user_id)
+			);
+
+			CREATE INDEX IF NOT EXISTS post_coauthors_user_id_idx ON post_coauthors (user_id);
+		`,
+	},
+	{
+		version: 12,
+		name:    "media",
+		sql: `
+			-- Usage is not stored; it is counted from post content on read
+			CREATE TABLE IF NOT EXISTS media (
+				id TEXT PRIMARY KEY,
+				storage_key TEXT NOT NULL UNIQUE,
+				url TEXT NOT NULL,
+				filename TEXT NOT NULL,
+				content_type TEXT NOT NULL,
+				size BIGINT NOT NULL,
+				width INTEGER NOT NULL,
+				height INTEGER NOT NULL,
+				uploader_id TEXT NOT NULL REFERENCES users(id),
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS media_created_at_idx ON media (created_at DESC);
+			CREATE INDEX IF NOT EXISTS media_uploader_id_idx ON media (uploader_id);
+		`,
+	},
+	{
+		version: 13,
+		name:    "slugs unique among live posts",
+		sql: `
+			-- A trashed post keeps its slug but no longer blocks others from using it
+			ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_slug_key;
+			CREATE UNIQUE INDEX IF NOT EXISTS posts_slug_live_key ON posts (slug) WHERE deleted_at IS NULL;
+		`,
+	},
+	{
+		version: 14,
+		name:    "idempotency key leases",
+		sql: `
+			-- Requests in flight during the upgrade died with the old process
+			ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE;
+			UPDATE idempotency_keys SET locked_until = created_at WHERE status_code IS NULL;
+		`,
+	},
+	{
+		version: 15,
+		name:    "idempotency key etags",
+		sql: `
+			ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS etag TEXT NOT NULL DEFAULT '';
+		`,
+	},
+}
+
+// LatestVersion returns the schema version this build expects
+func LatestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// CurrentVersion returns the highest migration version applied to the database
+func CurrentVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version), 0) FROM schema_migrations
+	`).Scan(&version)
+	return version, err
+}
+
+// CheckMigrations returns an error if the database schema is behind this build
+func CheckMigrations(ctx context.Context, db *sql.DB) error {
+	current, err := CurrentVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	if latest := LatestVersion(); current < latest {
+		return fmt.Errorf("schema version %d is behind expected version %d", current, latest)
+	}
+
+	return nil
+}
+
+// migrate applies every pending migration, each in its own transaction.
+// A session-level advisory lock held on one connection for the whole run
+// keeps replicas starting together from applying the same migrations; the
+// others wait and then find nothing left to do.
+func migrate(db *sql.DB, logger *slog.Logger) error {
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reserve a connection for migrations: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock(hashtext('schema_migrations'))`); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext('schema_migrations'))`); err != nil {
+			logger.Warn("failed to release the migration lock", "error", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	// Read the version only once the lock is held, so that migrations
+	// another replica applied meanwhile are skipped
+	var current int
+	err = conn.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version), 0) FROM schema_migrations
+	`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(m.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+
+		if _, err := tx.Exec(`
+			INSERT INTO schema_migrations (version, name) VALUES ($1, $2)
+		`, m.version, m.name); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		logger.Info("applied migration", "version", m.version, "name", m.name)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/logging"
+	"github.com/biboy/blog/api/metrics"
+	"github.com/biboy/blog/api/models"
+)
+
+// ArchiveHandler handles HTTP requests for the chronological archive
+type ArchiveHandler struct {
+	postService *models.PostService
+	log         *slog.Logger
+	httpCache   config.HTTPCacheConfig
+	location    *time.Location
+}
+
+// NewArchiveHandler creates a new archive handler
+func NewArchiveHandler(db *sql.DB, logger *slog.Logger, m *metrics.Metrics, loader *cache.Loader, cfg *config.Config) *ArchiveHandler {
+	// Validate has already rejected unknown zones
+	location, err := time.LoadLocation(cfg.Site.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	return &ArchiveHandler{
+		postService: models.NewPostService(db, logging.Component(logger, "models"), m, loader, cfg.Cache),
+		log:         logging.Component(logger, "handlers"),
+		httpCache:   cfg.HTTPCache,
+		location:    location,
+	}
+}
+
+// RegisterRoutes registers the archive routes with the given router group
+func (h *ArchiveHandler) RegisterRoutes(router *gin.RouterGroup) {
+	archive := router.Group("/archive")
+	{
+		archive.GET("", h.GetArchive)
+		archive.GET("/:year/:month", h.GetArchiveMonth)
+	}
+}
+
+// GetArchive returns the number of published posts per year and month
+func (h *ArchiveHandler) GetArchive(c *gin.Context) {
+	years, err := h.postService.GetArchive(c.Request.Context(), h.location)
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve archive", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve archive"})
+		return
+	}
+
+	// Counts carry no timestamps, so only the ETag validates them
+	respondCacheable(c, h.httpCache.Archive, time.Time{}, years)
+}
+
+// GetArchiveMonth returns a page of the posts published in one month
+func (h *ArchiveHandler) GetArchiveMonth(c *gin.Context) {
+	year, err := strconv.Atoi(c.Param("year"))
+	if err != nil || year < 1 || year > 9999 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return
+	}
+
+	month, err := strconv.Atoi(c.Param("month"))
+	if err != nil || month < 1 || month > 12 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month: must be between 1 and 12"})
+		return
+	}
+
+	page, limit := parsePage(c)
+
+	posts, total, err := h.postService.GetPublishedInMonth(c.Request.Context(), h.location, year, time.Month(month), page, limit)
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve posts for month", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve posts"})
+		return
+	}
+
+	// Removing a post or comment takes its timestamp off the page, so only
+	// the ETag validates the list
+	respondCacheable(c, h.httpCache.Archive, time.Time{}, gin.H{
+		"year":  year,
+		"month": month,
+		"posts": posts,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
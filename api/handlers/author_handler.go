@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/logging"
+	"github.com/biboy/blog/api/metrics"
+	"github.com/biboy/blog/api/middleware"
+	"github.com/biboy/blog/api/models"
+)
+
+// Limits on what an author can put in their profile
+const (
+	maxBioLength     = 2000
+	maxProfileLinks  = 10
+	maxLinkKeyLength = 32
+)
+
+// AuthorHandler handles HTTP requests for author profiles
+type AuthorHandler struct {
+	authorService *models.AuthorService
+	postService   *models.PostService
+	log           *slog.Logger
+	httpCache     config.HTTPCacheConfig
+}
+
+// NewAuthorHandler creates a new author handler
+func NewAuthorHandler(db *sql.DB, logger *slog.Logger, m *metrics.Metrics, loader *cache.Loader, cfg *config.Config) *AuthorHandler {
+	return &AuthorHandler{
+		authorService: models.NewAuthorService(db, logging.Component(logger, "models")),
+		postService:   models.NewPostService(db, logging.Component(logger, "models"), m, loader, cfg.Cache),
+		log:           logging.Component(logger, "handlers"),
+		httpCache:     cfg.HTTPCache,
+	}
+}
+
+// RegisterRoutes registers the author routes with the given router group
+func (h *AuthorHandler) RegisterRoutes(router *gin.RouterGroup) {
+	authors := router.Group("/authors")
+	{
+		authors.GET("", h.GetAllAuthors)
+		authors.GET("/:id", h.GetAuthor)
+		authors.PUT("/:id/profile", h.UpdateProfile)
+	}
+}
+
+// GetAllAuthors returns the profiles of everyone with a published post
+func (h *AuthorHandler) GetAllAuthors(c *gin.Context) {
+	authors, err := h.authorService.GetAll(c.Request.Context())
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve authors", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve authors"})
+		return
+	}
+
+	// Profiles carry no timestamps, so only the ETag validates them
+	respondCacheable(c, h.httpCache.Authors, time.Time{}, authors)
+}
+
+// GetAuthor returns an author's profile with a page of their published posts
+func (h *AuthorHandler) GetAuthor(c *gin.Context) {
+	page, limit := parsePage(c)
+
+	author, err := h.authorService.GetByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Author not found"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve author", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve author"})
+		}
+		return
+	}
+
+	posts, total, err := h.postService.GetPublishedByAuthor(c.Request.Context(), author.ID, page, limit)
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve posts for author", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve posts"})
+		return
+	}
+
+	// The profile itself has no timestamp, so only the ETag validates it.
+	// Posts are projected so that their authors' and commenters' email
+	// addresses stay private, as the profile's does.
+	respondCacheable(c, h.httpCache.Authors, time.Time{}, gin.H{
+		"author": author,
+		"posts":  models.PublicPosts(posts),
+		"page":   page,
+		"limit":  limit,
+		"total":  total,
+	})
+}
+
+// UpdateProfile lets authors edit their own bio and links
+func (h *AuthorHandler) UpdateProfile(c *gin.Context) {
+	var request struct {
+		models.AuthorProfileData
+		Author models.Author `json:"author"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	middleware.SetUser(c, request.Author.ID)
+
+	id := c.Param("id")
+	if request.Author.ID != id {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own profile"})
+		return
+	}
+
+	if msg := validateProfile(request.AuthorProfileData); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + msg})
+		return
+	}
+
+	author, err := h.authorService.UpdateProfile(c.Request.Context(), id, request.AuthorProfileData)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Author not found"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to update author profile", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, author)
+}
+
+// validateProfile describes what is wrong with a profile edit, or returns
+// an empty string when it is valid
+func validateProfile(data models.AuthorProfileData) string {
+	if utf8.RuneCountInString(data.Bio) > maxBioLength {
+		return "bio must be at most 2000 characters"
+	}
+	if len(data.Links) > maxProfileLinks {
+		return "at most 10 links are allowed"
+	}
+	for name, link := range data.Links {
+		if name == "" || len(name) > maxLinkKeyLength {
+			return "link names must be between 1 and 32 characters"
+		}
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "links must be http or https URLs"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/logging"
+	"github.com/biboy/blog/api/metrics"
+	"github.com/biboy/blog/api/models"
+)
+
+// CategoryHandler handles HTTP requests for categories
+type CategoryHandler struct {
+	categoryService *models.CategoryService
+	postService     *models.PostService
+	log             *slog.Logger
+	httpCache       config.HTTPCacheConfig
+}
+
+// NewCategoryHandler creates a new category handler
+func NewCategoryHandler(db *sql.DB, logger *slog.Logger, m *metrics.Metrics, loader *cache.Loader, cfg *config.Config) *CategoryHandler {
+	return &CategoryHandler{
+		categoryService: models.NewCategoryService(db, logging.Component(logger, "models"), loader, cfg.Cache),
+		postService:     models.NewPostService(db, logging.Component(logger, "models"), m, loader, cfg.Cache),
+		log:             logging.Component(logger, "handlers"),
+		httpCache:       cfg.HTTPCache,
+	}
+}
+
+// RegisterRoutes registers the category routes with the given router group
+func (h *CategoryHandler) RegisterRoutes(router *gin.RouterGroup) {
+	categories := router.Group("/categories")
+	{
+		categories.GET("", h.GetCategoryTree)
+		categories.GET("/:id", h.GetCategoryByID)
+		categories.GET("/slug/:slug", h.GetCategoryBySlug)
+		categories.POST("", h.CreateCategory)
+		categories.PUT("/:id", h.UpdateCategory)
+		categories.DELETE("/:id", h.DeleteCategory)
+	}
+}
+
+// GetCategoryTree returns every category nested under its parent
+func (h *CategoryHandler) GetCategoryTree(c *gin.Context) {
+	tree, err := h.categoryService.Tree(c.Request.Context())
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve categories", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve categories"})
+		return
+	}
+
+	// Categories carry no timestamps, so only the ETag validates them
+	respondCacheable(c, h.httpCache.Categories, time.Time{}, tree)
+}
+
+// GetCategoryByID returns a category by ID
+func (h *CategoryHandler) GetCategoryByID(c *gin.Context) {
+	category, err := h.categoryService.GetByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve category", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve category"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// GetCategoryBySlug returns a category with a page of the published posts
+// in it and its subcategories
+func (h *CategoryHandler) GetCategoryBySlug(c *gin.Context) {
+	page, limit := parsePage(c)
+
+	category, err := h.categoryService.GetBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve category", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve category"})
+		}
+		return
+	}
+
+	posts, total, err := h.postService.GetPublishedInCategory(c.Request.Context(), category.ID, page, limit)
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve posts for category", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve posts"})
+		return
+	}
+
+	// Removing a post or comment takes its timestamp off the page, so only
+	// the ETag validates the list
+	respondCacheable(c, h.httpCache.Category, time.Time{}, gin.H{
+		"category": category,
+		"posts":    posts,
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+	})
+}
+
+// CreateCategory adds a new category
+func (h *CategoryHandler) CreateCategory(c *gin.Context) {
+	request, ok := bindCategoryForm(c)
+	if !ok {
+		return
+	}
+
+	category, err := h.categoryService.Create(c.Request.Context(), request)
+	if err != nil {
+		h.respondCategoryError(c, "failed to create category", "Failed to create category", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// UpdateCategory modifies a category, possibly moving it under another parent
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
+	request, ok := bindCategoryForm(c)
+	if !ok {
+		return
+	}
+
+	category, err := h.categoryService.Update(c.Request.Context(), c.Param("id"), request)
+	if err != nil {
+		h.respondCategoryError(c, "failed to update category", "Failed to update category", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// DeleteCategory removes a category that has no subcategories
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	if err := h.categoryService.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		h.respondCategoryError(c, "failed to delete category", "Failed to delete category", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// respondCategoryError maps category service errors to responses, logging
+// unexpected ones with logMsg
+func (h *CategoryHandler) respondCategoryError(c *gin.Context, logMsg, userMsg string, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	case errors.Is(err, models.ErrCategoryNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+	case errors.Is(err, models.ErrCategoryCycle):
+		c.JSON(http.StatusConflict, gin.H{"error": "A category cannot be moved under itself or its subcategories"})
+	case errors.Is(err, models.ErrCategoryHasChildren):
+		c.JSON(http.StatusConflict, gin.H{"error": "Move or delete the subcategories first"})
+	case errors.Is(err, models.ErrCategorySlugTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "A category with this slug already exists"})
+	default:
+		h.log.ErrorContext(c.Request.Context(), logMsg, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": userMsg})
+	}
+}
+
+// bindCategoryForm decodes and validates a category body, answering 400
+// when it is invalid
+func bindCategoryForm(c *gin.Context) (models.CategoryFormData, bool) {
+	var request models.CategoryFormData
+	if err := c.ShouldBindJSON(&request); err != nil || models.NormalizeName(request.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: category name is required"})
+		return request, false
+	}
+	if request.Slug != "" && !models.ValidSlug(request.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: slug must be lower-case letters, digits and hyphens"})
+		return request, false
+	}
+	return request, true
+}
@@ -2,23 +2,32 @@ package handlers
 
 import (
 	"database/sql"
+	"log/slog"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
-	"github.com/biboy/blog/api/db"
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/logging"
+	"github.com/biboy/blog/api/metrics"
+	"github.com/biboy/blog/api/middleware"
 	"github.com/biboy/blog/api/models"
 )
 
 // CommentHandler handles HTTP requests for comments
 type CommentHandler struct {
 	commentService *models.CommentService
+	idempotency    *models.IdempotencyService
+	log            *slog.Logger
 }
 
 // NewCommentHandler creates a new comment handler
-func NewCommentHandler() *CommentHandler {
+func NewCommentHandler(db *sql.DB, logger *slog.Logger, m *metrics.Metrics, loader *cache.Loader, cfg *config.Config) *CommentHandler {
 	return &CommentHandler{
-		commentService: models.NewCommentService(db.GetDB()),
+		commentService: models.NewCommentService(db, logging.Component(logger, "models"), m, loader),
+		idempotency:    models.NewIdempotencyService(db, logging.Component(logger, "models"), cfg.Idempotency),
+		log:            logging.Component(logger, "handlers"),
 	}
 }
 
@@ -40,8 +49,9 @@ func (h *CommentHandler) GetCommentsByPostID(c *gin.Context) {
 		return
 	}
 
-	comments, err := h.commentService.GetByPostID(postID)
+	comments, err := h.commentService.GetByPostID(c.Request.Context(), postID)
 	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve comments", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
 		return
 	}
@@ -61,19 +71,25 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
+	middleware.SetUser(c, request.Author.ID)
 
 	if request.PostID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Post ID is required"})
 		return
 	}
 
-	comment, err := h.commentService.Create(request.PostID, request.Comment, request.Author)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
-		return
-	}
+	respondIdempotent(c, h.idempotency, h.log, request.Author.ID, request, func() (int, any) {
+		comment, err := h.commentService.Create(c.Request.Context(), request.PostID, request.Comment, request.Author)
+		if err == sql.ErrNoRows {
+			return http.StatusNotFound, gin.H{"error": "Post not found"}
+		}
+		if err != nil {
+			h.log.ErrorContext(c.Request.Context(), "failed to create comment", "error", err)
+			return http.StatusInternalServerError, gin.H{"error": "Failed to create comment"}
+		}
 
-	c.JSON(http.StatusCreated, comment)
+		return http.StatusCreated, comment
+	})
 }
 
 // DeleteComment removes a comment
@@ -84,10 +100,11 @@ func (h *CommentHandler) DeleteComment(c *gin.Context) {
 		return
 	}
 
-	if err := h.commentService.Delete(id); err != nil {
+	if err := h.commentService.Delete(c.Request.Context(), id); err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
 		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to delete comment", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
 		}
 		return
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/biboy/blog/api/models"
+)
+
+// respondCacheable writes body as JSON with a strong ETag, Last-Modified
+// (when known) and the given Cache-Control policy, answering 304 Not
+// Modified when the request's validators still match
+func respondCacheable(c *gin.Context, cacheControl string, lastModified time.Time, body any) {
+	respondTagged(c, cacheControl, lastModified, "", body)
+}
+
+// respondPost is respondCacheable for a single post. Its ETag starts with
+// the post's version, as in "v3-<digest>", so the ETag of any post
+// representation can be sent back as If-Match on PUT and PATCH, while the
+// digest still changes with comments and navigation for If-None-Match.
+func respondPost(c *gin.Context, cacheControl string, lastModified time.Time, post models.Post) {
+	respondTagged(c, cacheControl, lastModified, fmt.Sprintf("v%d-", post.Version), post)
+}
+
+// respondTagged implements respondCacheable, prefixing the content digest
+// in the ETag with prefix
+func respondTagged(c *gin.Context, cacheControl string, lastModified time.Time, prefix string, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode response"})
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + prefix + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+
+	header := c.Writer.Header()
+	header.Set("ETag", etag)
+	if cacheControl != "" {
+		header.Set("Cache-Control", cacheControl)
+	}
+	if !lastModified.IsZero() {
+		header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since
+// only when no entity tag was sent (RFC 9110, section 13.2.2)
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagListMatches(inm, etag, true)
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// etagListMatches reports whether a comma-separated If-Match or
+// If-None-Match header matches etag; weak comparison ignores W/ prefixes
+func etagListMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+			etag = strings.TrimPrefix(etag, "W/")
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
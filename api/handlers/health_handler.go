@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/db"
+	"github.com/biboy/blog/api/logging"
+)
+
+// CheckResult reports the outcome of a single readiness check; the cause
+// of a failure is only logged, since probes may be reachable publicly
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latencyMs"`
+}
+
+// HealthHandler serves liveness and readiness probes
+type HealthHandler struct {
+	db  *sql.DB
+	cfg config.HealthConfig
+	log *slog.Logger
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(database *sql.DB, cfg config.HealthConfig, logger *slog.Logger) *HealthHandler {
+	return &HealthHandler{
+		db:  database,
+		cfg: cfg,
+		log: logging.Component(logger, "handlers"),
+	}
+}
+
+// RegisterRoutes registers the probe routes with the given router group
+func (h *HealthHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/livez", h.Livez)
+	router.GET("/readyz", h.Readyz)
+}
+
+// Livez reports whether the process is running and able to serve requests
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the dependencies needed to serve traffic are available
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	checks := map[string]CheckResult{
+		"database": h.runCheck(c.Request.Context(), "database", h.db.PingContext),
+		"migrations": h.runCheck(c.Request.Context(), "migrations", func(ctx context.Context) error {
+			return db.CheckMigrations(ctx, h.db)
+		}),
+	}
+
+	status, code := "ok", http.StatusOK
+	for _, check := range checks {
+		if check.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// runCheck runs check with the readiness timeout and records its latency,
+// logging why it failed under name
+func (h *HealthHandler) runCheck(parent context.Context, name string, check func(context.Context) error) CheckResult {
+	ctx, cancel := context.WithTimeout(parent, h.cfg.ReadinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := CheckResult{
+		Status:    "ok",
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = "error"
+		h.log.WarnContext(parent, "readiness check failed", "check", name, "error", err)
+	}
+
+	return result
+}
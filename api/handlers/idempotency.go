@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/biboy/blog/api/models"
+)
+
+const (
+	// idempotencyKeyHeader carries the client-chosen key for a create request
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks responses replayed from a stored key
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength bounds keys; UUIDs and ULIDs fit comfortably
+	maxIdempotencyKeyLength = 255
+)
+
+// respondIdempotent runs create and writes its response. When the request
+// carries an Idempotency-Key, the first response for that key and userID is
+// stored and replayed on retries, together with the ETag create set, so a
+// retrying client still gets a validator for If-Match; reusing the key for
+// a different request gets 422. Server errors are not stored, so the client
+// may retry them.
+func respondIdempotent(c *gin.Context, service *models.IdempotencyService, logger *slog.Logger, userID string, request any, create func() (int, any)) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		status, body := create()
+		c.JSON(status, body)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	requestHash, err := idempotencyHash(c.Request.Method, c.FullPath(), request)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode request"})
+		return
+	}
+
+	stored, err := service.Reserve(ctx, userID, key, requestHash)
+	switch {
+	case errors.Is(err, models.ErrIdempotencyKeyReused):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+		return
+	case errors.Is(err, models.ErrIdempotencyKeyInFlight):
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+		return
+	case err != nil:
+		logger.ErrorContext(ctx, "failed to reserve idempotency key", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+		return
+	case stored != nil:
+		c.Header(idempotentReplayedHeader, "true")
+		if stored.ETag != "" {
+			c.Header("ETag", stored.ETag)
+		}
+		c.Data(stored.StatusCode, "application/json; charset=utf-8", stored.Body)
+		return
+	}
+
+	// Record the outcome even if the client has gone away, so its retry
+	// replays the response instead of waiting for the key to expire
+	storeCtx := context.WithoutCancel(ctx)
+
+	status, body := create()
+	data, err := json.Marshal(body)
+	if err != nil || status >= http.StatusInternalServerError {
+		if err := service.Release(storeCtx, userID, key); err != nil {
+			logger.ErrorContext(ctx, "failed to release idempotency key", "error", err)
+		}
+		c.JSON(status, body)
+		return
+	}
+
+	if err := service.Complete(storeCtx, userID, key, models.StoredResponse{
+		StatusCode: status,
+		Body:       data,
+		ETag:       c.Writer.Header().Get("ETag"),
+	}); err != nil {
+		logger.ErrorContext(ctx, "failed to store idempotent response", "error", err)
+	}
+	c.Data(status, "application/json; charset=utf-8", data)
+}
+
+// idempotencyHash fingerprints a decoded request so that formatting
+// differences in the JSON body do not count as a different payload
+func idempotencyHash(method, route string, request any) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.New()
+	sum.Write([]byte(method + " " + route + "\n"))
+	sum.Write(data)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
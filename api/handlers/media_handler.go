@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/logging"
+	"github.com/biboy/blog/api/middleware"
+	"github.com/biboy/blog/api/models"
+	"github.com/biboy/blog/api/storage"
+)
+
+// multipartOverhead is room in an upload's body for the form fields and
+// part headers around the file itself
+const multipartOverhead = 64 << 10
+
+// MediaHandler handles HTTP requests for uploaded media
+type MediaHandler struct {
+	mediaService *models.MediaService
+	log          *slog.Logger
+	maxBytes     int64
+}
+
+// NewMediaHandler creates a new media handler storing files in store
+func NewMediaHandler(db *sql.DB, logger *slog.Logger, loader *cache.Loader, store storage.Storage, cfg *config.Config) *MediaHandler {
+	return &MediaHandler{
+		mediaService: models.NewMediaService(db, logging.Component(logger, "models"), loader, store),
+		log:          logging.Component(logger, "handlers"),
+		maxBytes:     int64(cfg.Media.MaxBytes),
+	}
+}
+
+// RegisterRoutes registers the media routes with the given router group
+func (h *MediaHandler) RegisterRoutes(router *gin.RouterGroup) {
+	media := router.Group("/media")
+	{
+		media.GET("", h.GetAllMedia)
+		media.POST("", h.UploadMedia)
+		media.DELETE("/:id", h.DeleteMedia)
+	}
+}
+
+// GetAllMedia returns a page of uploaded media, newest first
+func (h *MediaHandler) GetAllMedia(c *gin.Context) {
+	page, limit := parsePage(c)
+
+	media, total, err := h.mediaService.GetAll(c.Request.Context(), page, limit)
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve media", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve media"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"media": media,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// UploadMedia stores an image sent as the "file" part of a multipart form,
+// with the uploader as JSON in its "author" field
+func (h *MediaHandler) UploadMedia(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxBytes+multipartOverhead)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.respondTooLarge(c)
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required"})
+		}
+		return
+	}
+	if header.Size > h.maxBytes {
+		h.respondTooLarge(c)
+		return
+	}
+
+	var author models.Author
+	if err := json.Unmarshal([]byte(c.PostForm("author")), &author); err != nil || author.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Author is required"})
+		return
+	}
+	middleware.SetUser(c, author.ID)
+
+	file, err := header.Open()
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to open uploaded file", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload media"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to read uploaded file", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload media"})
+		return
+	}
+
+	media, err := h.mediaService.Upload(c.Request.Context(), filepath.Base(header.Filename), data, author)
+	if err != nil {
+		if errors.Is(err, models.ErrUnsupportedMedia) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Only PNG, JPEG, GIF and WebP images can be uploaded"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to upload media", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload media"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, media)
+}
+
+// DeleteMedia removes uploaded media. Media still embedded in posts is only
+// removed with ?force=true.
+func (h *MediaHandler) DeleteMedia(c *gin.Context) {
+	force := c.Query("force") == "true"
+
+	if err := h.mediaService.Delete(c.Request.Context(), c.Param("id"), force); err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		case errors.Is(err, models.ErrMediaInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": "Media is used by posts; pass force=true to delete it anyway"})
+		default:
+			h.log.ErrorContext(c.Request.Context(), "failed to delete media", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Media deleted successfully"})
+}
+
+// respondTooLarge rejects an upload over the configured size limit
+func (h *MediaHandler) respondTooLarge(c *gin.Context) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":    "File is too large",
+		"maxBytes": h.maxBytes,
+	})
+}
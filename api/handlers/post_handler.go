@@ -1,25 +1,42 @@
 package handlers
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
-	"github.com/biboy/blog/api/db"
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/logging"
+	"github.com/biboy/blog/api/metrics"
+	"github.com/biboy/blog/api/middleware"
 	"github.com/biboy/blog/api/models"
 )
 
 // PostHandler handles HTTP requests for blog posts
 type PostHandler struct {
 	postService *models.PostService
+	idempotency *models.IdempotencyService
+	log         *slog.Logger
+	httpCache   config.HTTPCacheConfig
 }
 
 // NewPostHandler creates a new post handler
-func NewPostHandler() *PostHandler {
+func NewPostHandler(db *sql.DB, logger *slog.Logger, m *metrics.Metrics, loader *cache.Loader, cfg *config.Config) *PostHandler {
 	return &PostHandler{
-		postService: models.NewPostService(db.GetDB()),
+		postService: models.NewPostService(db, logging.Component(logger, "models"), m, loader, cfg.Cache),
+		idempotency: models.NewIdempotencyService(db, logging.Component(logger, "models"), cfg.Idempotency),
+		log:         logging.Component(logger, "handlers"),
+		httpCache:   cfg.HTTPCache,
 	}
 }
 
@@ -30,35 +47,28 @@ func (h *PostHandler) RegisterRoutes(router *gin.RouterGroup) {
 		posts.GET("", h.GetAllPosts)
 		posts.GET("/:id", h.GetPostByID)
 		posts.GET("/slug/:slug", h.GetPostBySlug)
+		posts.GET("/:id/related", h.GetRelatedPosts)
 		posts.POST("", h.CreatePost)
 		posts.PUT("/:id", h.UpdatePost)
+		posts.PATCH("/:id", h.PatchPost)
 		posts.DELETE("/:id", h.DeletePost)
 	}
 }
 
 // GetAllPosts returns all posts
 func (h *PostHandler) GetAllPosts(c *gin.Context) {
-	// Get page and limit from query parameters
-	pageStr := c.DefaultQuery("page", "1")
-	limitStr := c.DefaultQuery("limit", "10")
+	page, limit := parsePage(c)
 
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
-	}
-
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 {
-		limit = 10 // Default limit
-	}
-
-	posts, err := h.postService.GetAll(page, limit)
+	posts, err := h.postService.GetAll(c.Request.Context(), page, limit)
 	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve posts", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve posts"})
 		return
 	}
 
-	c.JSON(http.StatusOK, posts)
+	// Removing a post or comment takes its timestamp off the page, so only
+	// the ETag validates the list
+	respondCacheable(c, h.httpCache.PostList, time.Time{}, posts)
 }
 
 // GetPostByID returns a post by ID
@@ -69,17 +79,19 @@ func (h *PostHandler) GetPostByID(c *gin.Context) {
 		return
 	}
 
-	post, err := h.postService.GetByID(id)
+	post, err := h.postService.GetByID(c.Request.Context(), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve post", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve post"})
 		}
 		return
 	}
 
-	c.JSON(http.StatusOK, post)
+	// Editors load posts by ID, so always revalidate; drafts are included
+	respondPost(c, h.httpCache.Draft, time.Time{}, post)
 }
 
 // GetPostBySlug returns a post by slug
@@ -90,17 +102,75 @@ func (h *PostHandler) GetPostBySlug(c *gin.Context) {
 		return
 	}
 
-	post, err := h.postService.GetBySlug(slug)
+	post, err := h.postService.GetBySlug(c.Request.Context(), slug)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve post", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve post"})
 		}
 		return
 	}
 
-	c.JSON(http.StatusOK, post)
+	// Drafts must never be stored by shared caches
+	cacheControl := h.httpCache.Post
+	if !post.Published {
+		cacheControl = h.httpCache.Draft
+	}
+
+	modified := lastModified(post)
+	if c.Query("adjacent") == "true" {
+		scope := models.AdjacentScope{Tag: c.Query("tag"), Category: c.Query("category")}
+		if scope.Tag != "" && scope.Category != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: scope navigation by tag or category, not both"})
+			return
+		}
+
+		adjacent, err := h.postService.GetAdjacent(c.Request.Context(), post.ID, scope)
+		if err != nil {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve adjacent posts", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve post"})
+			return
+		}
+		// The cached post is shared, so attach the navigation to this copy only
+		post.Adjacent = &adjacent
+
+		// Neighbours change without touching this post, so only the ETag
+		// validates the response
+		modified = time.Time{}
+	}
+
+	respondPost(c, cacheControl, modified, post)
+}
+
+// maxRelatedPosts caps the limit of GetRelatedPosts
+const maxRelatedPosts = 20
+
+// GetRelatedPosts returns the published posts most similar to a post,
+// with their scores, best first
+func (h *PostHandler) GetRelatedPosts(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "5"))
+	if err != nil || limit < 1 {
+		limit = 5
+	}
+	if limit > maxRelatedPosts {
+		limit = maxRelatedPosts
+	}
+
+	related, err := h.postService.GetRelated(c.Request.Context(), c.Param("id"), limit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve related posts", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve related posts"})
+		}
+		return
+	}
+
+	// Scores change whenever any post does, so only the ETag validates them
+	respondCacheable(c, h.httpCache.Related, time.Time{}, related)
 }
 
 // CreatePost adds a new post
@@ -114,14 +184,30 @@ func (h *PostHandler) CreatePost(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
+	middleware.SetUser(c, request.Author.ID)
 
-	post, err := h.postService.Create(request.Post, request.Author)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create post"})
-		return
-	}
+	respondIdempotent(c, h.idempotency, h.log, request.Author.ID, request, func() (int, any) {
+		post, err := h.postService.Create(c.Request.Context(), request.Post, request.Author)
+		if errors.Is(err, models.ErrCategoryNotFound) {
+			return http.StatusBadRequest, gin.H{"error": "Category not found"}
+		}
+		if errors.Is(err, models.ErrCoAuthorNotFound) {
+			return http.StatusBadRequest, gin.H{"error": "Co-author not found"}
+		}
+		if errors.Is(err, models.ErrInvalidCoAuthors) {
+			return http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()}
+		}
+		if errors.Is(err, models.ErrPostSlugTaken) {
+			return http.StatusConflict, gin.H{"error": "Slug is already used by another post"}
+		}
+		if err != nil {
+			h.log.ErrorContext(c.Request.Context(), "failed to create post", "error", err)
+			return http.StatusInternalServerError, gin.H{"error": "Failed to create post"}
+		}
 
-	c.JSON(http.StatusCreated, post)
+		c.Header("ETag", postETag(post.Version))
+		return http.StatusCreated, post
+	})
 }
 
 // UpdatePost modifies an existing post
@@ -132,26 +218,103 @@ func (h *PostHandler) UpdatePost(c *gin.Context) {
 		return
 	}
 
+	// Require the version the client edited so concurrent edits are detected
+	version, ok := parseIfMatch(c.GetHeader("If-Match"))
+	if !ok {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the post's ETag is required"})
+		return
+	}
+
 	var request models.PostFormData
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
 
-	post, err := h.postService.Update(id, request)
+	post, err := h.postService.Update(c.Request.Context(), id, version, request)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
-		}
+		h.respondUpdateError(c, id, err)
 		return
 	}
 
+	c.Header("ETag", postETag(post.Version))
 	c.JSON(http.StatusOK, post)
 }
 
-// DeletePost removes a post
+// PatchPost partially updates a post using JSON Merge Patch semantics:
+// absent fields are left untouched and tags can be added or removed
+func (h *PostHandler) PatchPost(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post ID is required"})
+		return
+	}
+
+	// Require the version the client edited, as for PUT, so a patch cannot
+	// silently overwrite a concurrent edit
+	version, ok := parseIfMatch(c.GetHeader("If-Match"))
+	if !ok {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the post's ETag is required"})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	patch, err := decodePostPatch(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post, err := h.postService.Patch(c.Request.Context(), id, version, patch)
+	if err != nil {
+		h.respondUpdateError(c, id, err)
+		return
+	}
+
+	c.Header("ETag", postETag(post.Version))
+	c.JSON(http.StatusOK, post)
+}
+
+// respondUpdateError maps a failed update to a response; version conflicts
+// return 412 with the current post so the client can merge
+func (h *PostHandler) respondUpdateError(c *gin.Context, id string, err error) {
+	var conflict *models.VersionConflictError
+	switch {
+	case errors.As(err, &conflict):
+		current, err := h.postService.GetByID(c.Request.Context(), id)
+		if err != nil {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve post", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
+			return
+		}
+		c.Header("ETag", postETag(current.Version))
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error":          "Post has been modified by someone else",
+			"currentVersion": current.Version,
+			"current":        current,
+		})
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+	case errors.Is(err, models.ErrCategoryNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+	case errors.Is(err, models.ErrCoAuthorNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Co-author not found"})
+	case errors.Is(err, models.ErrInvalidCoAuthors):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+	case errors.Is(err, models.ErrPostSlugTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Slug is already used by another post"})
+	default:
+		h.log.ErrorContext(c.Request.Context(), "failed to update post", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
+	}
+}
+
+// DeletePost moves a post to the trash
 func (h *PostHandler) DeletePost(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
@@ -159,10 +322,147 @@ func (h *PostHandler) DeletePost(c *gin.Context) {
 		return
 	}
 
-	if err := h.postService.Delete(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post"})
+	if err := h.postService.Delete(c.Request.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to delete post", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post"})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
+
+// decodePostPatch parses a merge patch document. Scalar fields cannot be
+// null because every post needs them; "tags" may be null (remove all), an
+// array (replace all) or an object with "add" and "remove" lists.
+func decodePostPatch(body []byte) (models.PostPatch, error) {
+	var patch models.PostPatch
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return patch, errors.New("Invalid request format: body must be a JSON object")
+	}
+
+	for name, raw := range fields {
+		isNull := string(raw) == "null"
+		var target any
+		switch name {
+		case "title":
+			target = &patch.Title
+		case "content":
+			target = &patch.Content
+		case "excerpt":
+			target = &patch.Excerpt
+		case "slug":
+			target = &patch.Slug
+		case "published":
+			target = &patch.Published
+		case "tags":
+			tags, err := decodeTagPatch(raw, isNull)
+			if err != nil {
+				return patch, err
+			}
+			patch.Tags = &tags
+			continue
+		case "categoryId":
+			// null clears the category, like an empty ID
+			var categoryID string
+			if !isNull {
+				if err := json.Unmarshal(raw, &categoryID); err != nil {
+					return patch, fmt.Errorf("Invalid value for field %q", name)
+				}
+			}
+			patch.CategoryID = &categoryID
+			continue
+		case "coAuthors":
+			// null removes every co-author, like an empty list
+			coAuthors := []models.CoAuthor{}
+			if !isNull {
+				if err := json.Unmarshal(raw, &coAuthors); err != nil {
+					return patch, fmt.Errorf("Invalid value for field %q", name)
+				}
+			}
+			patch.CoAuthors = &coAuthors
+			continue
+		default:
+			return patch, fmt.Errorf("Unknown field %q", name)
+		}
+
+		if isNull {
+			return patch, fmt.Errorf("Field %q cannot be null", name)
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			return patch, fmt.Errorf("Invalid value for field %q", name)
+		}
+	}
+
+	return patch, nil
+}
+
+// decodeTagPatch parses the "tags" member of a post patch
+func decodeTagPatch(raw json.RawMessage, isNull bool) (models.TagPatch, error) {
+	var tags models.TagPatch
+	if isNull {
+		tags.Set = []string{}
+		return tags, nil
+	}
+
+	if err := json.Unmarshal(raw, &tags.Set); err == nil {
+		if tags.Set == nil {
+			tags.Set = []string{}
+		}
+		return tags, nil
+	}
+
+	tags.Set = nil
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&tags); err != nil {
+		return tags, errors.New(`Invalid value for field "tags": use an array or {"add": [...], "remove": [...]}`)
+	}
+	return tags, nil
+}
+
+// postETag formats a post version as a strong entity tag
+func postETag(version int) string {
+	return fmt.Sprintf(`"v%d"`, version)
+}
+
+// parseIfMatch extracts the expected post version from an If-Match header
+// holding either postETag or the ETag respondPost sent with a post, whose
+// content digest is ignored; "*" matches any version and yields 0
+func parseIfMatch(header string) (int, bool) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, true
+	}
+
+	tag, ok := strings.CutPrefix(header, `"v`)
+	if !ok {
+		return 0, false
+	}
+	tag, ok = strings.CutSuffix(tag, `"`)
+	if !ok {
+		return 0, false
+	}
+	tag, _, _ = strings.Cut(tag, "-")
+	version, err := strconv.Atoi(tag)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// lastModified returns when a post or any of its comments last changed
+func lastModified(post models.Post) time.Time {
+	modified := post.UpdatedAt
+	for _, comment := range post.Comments {
+		if comment.CreatedAt.After(modified) {
+			modified = comment.CreatedAt
+		}
+	}
+	return modified
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/logging"
+	"github.com/biboy/blog/api/models"
+)
+
+// SeriesHandler handles HTTP requests for post series
+type SeriesHandler struct {
+	seriesService *models.SeriesService
+	log           *slog.Logger
+	httpCache     config.HTTPCacheConfig
+}
+
+// NewSeriesHandler creates a new series handler
+func NewSeriesHandler(db *sql.DB, logger *slog.Logger, loader *cache.Loader, cfg *config.Config) *SeriesHandler {
+	return &SeriesHandler{
+		seriesService: models.NewSeriesService(db, logging.Component(logger, "models"), loader),
+		log:           logging.Component(logger, "handlers"),
+		httpCache:     cfg.HTTPCache,
+	}
+}
+
+// RegisterRoutes registers the public and admin series routes with the
+// given router group
+func (h *SeriesHandler) RegisterRoutes(router *gin.RouterGroup) {
+	series := router.Group("/series")
+	{
+		series.GET("", h.GetAllSeries)
+		series.GET("/slug/:slug", h.GetSeriesBySlug)
+	}
+
+	admin := router.Group("/admin/series")
+	{
+		admin.GET("/:id", h.GetSeriesByID)
+		admin.POST("", h.CreateSeries)
+		admin.PUT("/:id", h.UpdateSeries)
+		admin.PUT("/:id/posts", h.SetSeriesPosts)
+		admin.DELETE("/:id", h.DeleteSeries)
+	}
+}
+
+// GetAllSeries returns every series with its number of published posts
+func (h *SeriesHandler) GetAllSeries(c *gin.Context) {
+	series, err := h.seriesService.GetAll(c.Request.Context())
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve series", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve series"})
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// GetSeriesBySlug returns a series with its published posts in reading order
+func (h *SeriesHandler) GetSeriesBySlug(c *gin.Context) {
+	series, err := h.seriesService.GetBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Series not found"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve series", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve series"})
+		}
+		return
+	}
+
+	// Editing or trashing a member post leaves the series' updated_at as it
+	// was, so only the ETag validates the embedded posts
+	respondCacheable(c, h.httpCache.Series, time.Time{}, series)
+}
+
+// GetSeriesByID returns a series with all of its posts, including drafts
+func (h *SeriesHandler) GetSeriesByID(c *gin.Context) {
+	series, err := h.seriesService.GetByID(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Series not found"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve series", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve series"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// CreateSeries adds a new, empty series
+func (h *SeriesHandler) CreateSeries(c *gin.Context) {
+	request, ok := bindSeriesForm(c)
+	if !ok {
+		return
+	}
+
+	series, err := h.seriesService.Create(c.Request.Context(), request)
+	if err != nil {
+		h.respondSeriesError(c, "failed to create series", "Failed to create series", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, series)
+}
+
+// UpdateSeries modifies a series' title, slug and description
+func (h *SeriesHandler) UpdateSeries(c *gin.Context) {
+	request, ok := bindSeriesForm(c)
+	if !ok {
+		return
+	}
+
+	series, err := h.seriesService.Update(c.Request.Context(), c.Param("id"), request)
+	if err != nil {
+		h.respondSeriesError(c, "failed to update series", "Failed to update series", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// SetSeriesPosts replaces the posts of a series with the given IDs in
+// reading order; it is used both to add or remove posts and to reorder them
+func (h *SeriesHandler) SetSeriesPosts(c *gin.Context) {
+	var request struct {
+		PostIDs []string `json:"postIds"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: postIds must be a list of post IDs"})
+		return
+	}
+
+	series, err := h.seriesService.SetPosts(c.Request.Context(), c.Param("id"), request.PostIDs)
+	if err != nil {
+		h.respondSeriesError(c, "failed to set series posts", "Failed to update series posts", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// DeleteSeries removes a series, leaving its posts in place
+func (h *SeriesHandler) DeleteSeries(c *gin.Context) {
+	if err := h.seriesService.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		h.respondSeriesError(c, "failed to delete series", "Failed to delete series", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Series deleted successfully"})
+}
+
+// respondSeriesError maps series service errors to responses, logging
+// unexpected ones with logMsg
+func (h *SeriesHandler) respondSeriesError(c *gin.Context, logMsg, userMsg string, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Series not found"})
+	case errors.Is(err, models.ErrDuplicateSeriesPost):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: postIds lists a post more than once or an empty ID"})
+	case errors.Is(err, models.ErrSeriesPostNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post not found"})
+	case errors.Is(err, models.ErrPostInOtherSeries):
+		c.JSON(http.StatusConflict, gin.H{"error": "A post already belongs to another series"})
+	case errors.Is(err, models.ErrSeriesSlugTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "A series with this slug already exists"})
+	default:
+		h.log.ErrorContext(c.Request.Context(), logMsg, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": userMsg})
+	}
+}
+
+// bindSeriesForm decodes and validates a series body, answering 400 when
+// it is invalid
+func bindSeriesForm(c *gin.Context) (models.SeriesFormData, bool) {
+	var request models.SeriesFormData
+	if err := c.ShouldBindJSON(&request); err != nil || request.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: series title is required"})
+		return request, false
+	}
+	if request.Slug != "" && !models.ValidSlug(request.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: slug must be lower-case letters, digits and hyphens"})
+		return request, false
+	}
+	return request, true
+}
@@ -2,23 +2,35 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
-	"github.com/biboy/blog/api/db"
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/logging"
+	"github.com/biboy/blog/api/metrics"
 	"github.com/biboy/blog/api/models"
 )
 
 // TagHandler handles HTTP requests for tags
 type TagHandler struct {
-	tagService *models.TagService
+	tagService  *models.TagService
+	postService *models.PostService
+	log         *slog.Logger
+	httpCache   config.HTTPCacheConfig
 }
 
 // NewTagHandler creates a new tag handler
-func NewTagHandler() *TagHandler {
+func NewTagHandler(db *sql.DB, logger *slog.Logger, m *metrics.Metrics, loader *cache.Loader, cfg *config.Config) *TagHandler {
 	return &TagHandler{
-		tagService: models.NewTagService(db.GetDB()),
+		tagService:  models.NewTagService(db, logging.Component(logger, "models"), loader, cfg.Cache),
+		postService: models.NewPostService(db, logging.Component(logger, "models"), m, loader, cfg.Cache),
+		log:         logging.Component(logger, "handlers"),
+		httpCache:   cfg.HTTPCache,
 	}
 }
 
@@ -29,21 +41,39 @@ func (h *TagHandler) RegisterRoutes(router *gin.RouterGroup) {
 		tags.GET("", h.GetAllTags)
 		tags.GET("/:id", h.GetTagByID)
 		tags.GET("/name/:name", h.GetTagByName)
+		tags.GET("/slug/:slug", h.GetTagBySlug)
 		tags.POST("", h.CreateTag)
 		tags.PUT("/:id", h.UpdateTag)
 		tags.DELETE("/:id", h.DeleteTag)
 	}
+
+	admin := router.Group("/admin/tags")
+	{
+		admin.POST("/:id/aliases", h.AddTagAlias)
+		admin.DELETE("/:id/aliases/:alias", h.RemoveTagAlias)
+		admin.POST("/:id/merge", h.MergeTag)
+		admin.DELETE("/orphans", h.PruneOrphanTags)
+	}
 }
 
-// GetAllTags returns all tags
+// GetAllTags returns all tags, with published post counts when
+// withCounts=true
 func (h *TagHandler) GetAllTags(c *gin.Context) {
-	tags, err := h.tagService.GetAll()
+	var tags []models.Tag
+	var err error
+	if c.Query("withCounts") == "true" {
+		tags, err = h.tagService.GetAllWithCounts(c.Request.Context())
+	} else {
+		tags, err = h.tagService.GetAll(c.Request.Context())
+	}
 	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve tags", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
 		return
 	}
 
-	c.JSON(http.StatusOK, tags)
+	// Tags carry no timestamps, so only the ETag validates them
+	respondCacheable(c, h.httpCache.Tags, time.Time{}, tags)
 }
 
 // GetTagByID returns a tag by ID
@@ -54,11 +84,12 @@ func (h *TagHandler) GetTagByID(c *gin.Context) {
 		return
 	}
 
-	tag, err := h.tagService.GetByID(id)
+	tag, err := h.tagService.GetByID(c.Request.Context(), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
 		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve tag", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tag"})
 		}
 		return
@@ -67,7 +98,7 @@ func (h *TagHandler) GetTagByID(c *gin.Context) {
 	c.JSON(http.StatusOK, tag)
 }
 
-// GetTagByName returns a tag by name
+// GetTagByName returns a tag by name or alias, ignoring case
 func (h *TagHandler) GetTagByName(c *gin.Context) {
 	name := c.Param("name")
 	if name == "" {
@@ -75,11 +106,12 @@ func (h *TagHandler) GetTagByName(c *gin.Context) {
 		return
 	}
 
-	tag, err := h.tagService.GetByName(name)
+	tag, err := h.tagService.GetByName(c.Request.Context(), name)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
 		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve tag", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tag"})
 		}
 		return
@@ -88,20 +120,56 @@ func (h *TagHandler) GetTagByName(c *gin.Context) {
 	c.JSON(http.StatusOK, tag)
 }
 
-// CreateTag adds a new tag
-func (h *TagHandler) CreateTag(c *gin.Context) {
-	var request struct {
-		Name string `json:"name" binding:"required"`
+// GetTagBySlug returns a tag with a page of its published posts
+func (h *TagHandler) GetTagBySlug(c *gin.Context) {
+	page, limit := parsePage(c)
+
+	tag, err := h.tagService.GetBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to retrieve tag", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tag"})
+		}
+		return
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: tag name is required"})
+	posts, total, err := h.postService.GetPublishedByTag(c.Request.Context(), tag.ID, page, limit)
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve posts for tag", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve posts"})
+		return
+	}
+
+	// Removing a post or comment takes its timestamp off the page, so only
+	// the ETag validates the list
+	respondCacheable(c, h.httpCache.Tag, time.Time{}, gin.H{
+		"tag":   tag,
+		"posts": posts,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// CreateTag adds a new tag
+func (h *TagHandler) CreateTag(c *gin.Context) {
+	request, ok := bindTagForm(c)
+	if !ok {
 		return
 	}
 
-	tag, err := h.tagService.Create(request.Name)
+	tag, err := h.tagService.Create(c.Request.Context(), request)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+		if errors.Is(err, models.ErrTagNameTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A tag with this name or alias already exists"})
+		} else if errors.Is(err, models.ErrTagSlugTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A tag with this slug already exists"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to create tag", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+		}
 		return
 	}
 
@@ -116,20 +184,21 @@ func (h *TagHandler) UpdateTag(c *gin.Context) {
 		return
 	}
 
-	var request struct {
-		Name string `json:"name" binding:"required"`
-	}
-
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: tag name is required"})
+	request, ok := bindTagForm(c)
+	if !ok {
 		return
 	}
 
-	tag, err := h.tagService.Update(id, request.Name)
+	tag, err := h.tagService.Update(c.Request.Context(), id, request)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		} else if errors.Is(err, models.ErrTagNameTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A tag with this name or alias already exists"})
+		} else if errors.Is(err, models.ErrTagSlugTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A tag with this slug already exists"})
 		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to update tag", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
 		}
 		return
@@ -146,10 +215,111 @@ func (h *TagHandler) DeleteTag(c *gin.Context) {
 		return
 	}
 
-	if err := h.tagService.Delete(id); err != nil {
+	if err := h.tagService.Delete(c.Request.Context(), id); err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to delete tag", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
 }
+
+// AddTagAlias makes another name resolve to a tag
+func (h *TagHandler) AddTagAlias(c *gin.Context) {
+	var request struct {
+		Alias string `json:"alias" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || models.NormalizeName(request.Alias) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: alias is required"})
+		return
+	}
+
+	tag, err := h.tagService.AddAlias(c.Request.Context(), c.Param("id"), request.Alias)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		} else if errors.Is(err, models.ErrTagNameTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A tag with this name or alias already exists"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to add tag alias", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add tag alias"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// RemoveTagAlias deletes one of a tag's aliases
+func (h *TagHandler) RemoveTagAlias(c *gin.Context) {
+	if err := h.tagService.RemoveAlias(c.Request.Context(), c.Param("id"), c.Param("alias")); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag alias not found"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to remove tag alias", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove tag alias"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag alias removed successfully"})
+}
+
+// MergeTag moves every post from one tag to another and deletes the first
+func (h *TagHandler) MergeTag(c *gin.Context) {
+	var request struct {
+		Into string `json:"into" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: target tag ID is required in \"into\""})
+		return
+	}
+
+	tag, err := h.tagService.Merge(c.Request.Context(), c.Param("id"), request.Into)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		} else if errors.Is(err, models.ErrTagMergeSelf) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot merge a tag into itself"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to merge tags", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge tags"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// PruneOrphanTags deletes every tag that no post uses
+func (h *TagHandler) PruneOrphanTags(c *gin.Context) {
+	pruned, err := h.tagService.PruneOrphans(c.Request.Context())
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to prune tags", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prune tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pruned": pruned})
+}
+
+// bindTagForm decodes and validates a tag body, answering 400 when it is
+// invalid
+func bindTagForm(c *gin.Context) (models.TagFormData, bool) {
+	var request models.TagFormData
+	if err := c.ShouldBindJSON(&request); err != nil || models.NormalizeName(request.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: tag name is required"})
+		return request, false
+	}
+	if request.Slug != "" && !models.ValidSlug(request.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: slug must be lower-case letters, digits and hyphens"})
+		return request, false
+	}
+	if !models.ValidTagColor(request.Color) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: color must look like #1e90ff"})
+		return request, false
+	}
+	return request, true
+}
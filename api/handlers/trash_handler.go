@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/logging"
+	"github.com/biboy/blog/api/metrics"
+	"github.com/biboy/blog/api/models"
+)
+
+// TrashHandler handles admin requests for deleted posts
+type TrashHandler struct {
+	postService *models.PostService
+	log         *slog.Logger
+}
+
+// NewTrashHandler creates a new trash handler
+func NewTrashHandler(db *sql.DB, logger *slog.Logger, m *metrics.Metrics, loader *cache.Loader, cfg *config.Config) *TrashHandler {
+	return &TrashHandler{
+		postService: models.NewPostService(db, logging.Component(logger, "models"), m, loader, cfg.Cache),
+		log:         logging.Component(logger, "handlers"),
+	}
+}
+
+// RegisterRoutes registers the trash routes with the given router group
+func (h *TrashHandler) RegisterRoutes(router *gin.RouterGroup) {
+	trash := router.Group("/admin/trash/posts")
+	{
+		trash.GET("", h.ListTrashedPosts)
+		trash.POST("/:id/restore", h.RestorePost)
+		trash.DELETE("/:id", h.PurgePost)
+	}
+}
+
+// ListTrashedPosts returns deleted posts that have not been purged yet
+func (h *TrashHandler) ListTrashedPosts(c *gin.Context) {
+	page, limit := parsePage(c)
+
+	posts, err := h.postService.ListTrashed(c.Request.Context(), page, limit)
+	if err != nil {
+		h.log.ErrorContext(c.Request.Context(), "failed to retrieve trashed posts", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve trashed posts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, posts)
+}
+
+// RestorePost moves a post out of the trash, under the slug in ?slug= when
+// one is given
+func (h *TrashHandler) RestorePost(c *gin.Context) {
+	id := c.Param("id")
+
+	slug := c.Query("slug")
+	if slug != "" && !models.ValidSlug(slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: slug must be lower-case letters, digits and hyphens"})
+		return
+	}
+
+	post, err := h.postService.Restore(c.Request.Context(), id, slug)
+	if err != nil {
+		var taken *models.SlugTakenError
+		switch {
+		case err == sql.ErrNoRows:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found in trash"})
+		case errors.As(err, &taken):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":         "Slug is already used by another post; rename that post or restore with ?slug= to choose another",
+				"slug":          taken.Slug,
+				"conflictsWith": gin.H{"id": taken.PostID, "title": taken.Title},
+			})
+		case errors.Is(err, models.ErrPostSlugTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "Slug is already used by another post; restore with ?slug= to choose another"})
+		default:
+			h.log.ErrorContext(c.Request.Context(), "failed to restore post", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore post"})
+		}
+		return
+	}
+
+	c.Header("ETag", postETag(post.Version))
+	c.JSON(http.StatusOK, post)
+}
+
+// PurgePost permanently deletes a trashed post
+func (h *TrashHandler) PurgePost(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := h.postService.Purge(c.Request.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found in trash"})
+		} else {
+			h.log.ErrorContext(c.Request.Context(), "failed to purge post", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge post"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post permanently deleted"})
+}
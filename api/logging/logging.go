@@ -0,0 +1,121 @@
+// Package logging builds the structured logger shared by every layer of the
+// API and carries request-scoped values such as the request ID.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/biboy/blog/api/config"
+)
+
+// ComponentKey is the attribute naming the package a logger belongs to
+const ComponentKey = "component"
+
+// New creates a logger writing to w using cfg's format and levels
+func New(w io.Writer, cfg config.LogConfig) *slog.Logger {
+	levels := map[string]slog.Level{}
+	for _, entry := range cfg.Levels {
+		component, level, _ := strings.Cut(entry, "=")
+		var l slog.Level
+		// Levels are validated when the configuration is loaded
+		_ = l.UnmarshalText([]byte(level))
+		levels[strings.TrimSpace(component)] = l
+	}
+
+	var base slog.Level
+	_ = base.UnmarshalText([]byte(cfg.Level))
+
+	// The inner handler accepts everything; contextHandler filters by component
+	opts := &slog.HandlerOptions{Level: slog.Level(-8)}
+	var inner slog.Handler
+	if cfg.Format == "json" {
+		inner = slog.NewJSONHandler(w, opts)
+	} else {
+		inner = slog.NewTextHandler(w, opts)
+	}
+
+	return slog.New(&contextHandler{
+		inner:  inner,
+		base:   base,
+		levels: levels,
+		level:  base,
+	})
+}
+
+// Component returns a logger tagged with the given package name, whose
+// minimum level honours any per-package override
+func Component(logger *slog.Logger, name string) *slog.Logger {
+	return logger.With(ComponentKey, name)
+}
+
+// contextHandler adds request-scoped attributes and applies per-component levels
+type contextHandler struct {
+	inner  slog.Handler
+	base   slog.Level
+	levels map[string]slog.Level
+	level  slog.Level
+}
+
+// Enabled reports whether records at level should be logged
+func (h *contextHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+// Handle adds the request ID and trace IDs from ctx before delegating
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+// WithAttrs switches to the component's level when a component is attached
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.inner = h.inner.WithAttrs(attrs)
+	for _, a := range attrs {
+		if a.Key != ComponentKey {
+			continue
+		}
+		if level, ok := h.levels[a.Value.String()]; ok {
+			clone.level = level
+		} else {
+			clone.level = h.base
+		}
+	}
+	return &clone
+}
+
+// WithGroup delegates grouping to the inner handler
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.inner = h.inner.WithGroup(name)
+	return &clone
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, if any
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
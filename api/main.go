@@ -1,61 +1,104 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	// Embed the zone database so site.time_zone works without system tzdata
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
 	"github.com/biboy/blog/api/db"
 	"github.com/biboy/blog/api/handlers"
+	"github.com/biboy/blog/api/logging"
+	"github.com/biboy/blog/api/metrics"
+	"github.com/biboy/blog/api/middleware"
+	"github.com/biboy/blog/api/models"
+	"github.com/biboy/blog/api/storage"
+	"github.com/biboy/blog/api/tracing"
 )
 
 func main() {
-	// Load environment variables from .env.local
-	if err := godotenv.Load(".env.local"); err != nil {
-		log.Println("Warning: .env.local file not found, using environment variables")
-	}
-
-	// Get the database URL from environment variables
-	dbURL := os.Getenv("NEON_DATABASE_URL")
-	if dbURL == "" {
-		// Try with VITE_ prefix (as seen in .env.local)
-		dbURL = os.Getenv("VITE_NEON_DATABASE_URL")
-		if dbURL == "" {
-			log.Fatal("Database URL not found in environment variables")
-		}
+	// Load configuration from defaults, config file, environment and flags
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	// Initialize database schema
-	if err := db.InitSchema(); err != nil {
-		log.Fatal("Failed to initialize database schema: ", err)
+	// Route every log line, including the standard library's, through slog
+	logger := logging.New(os.Stdout, cfg.Log)
+	slog.SetDefault(logger)
+	logger.Info("loaded configuration\n" + cfg.String())
+
+	// Install the tracer provider before anything creates spans
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal(logger, "failed to set up tracing", err)
 	}
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Connect to the database
+	database, err := db.Connect(cfg.Database, logging.Component(logger, "db"))
+	if err != nil {
+		fatal(logger, "failed to connect to database", err)
 	}
 
-	// Initialize Gin router
-	router := gin.Default()
+	// Initialize database schema
+	if err := db.InitSchema(database, logging.Component(logger, "db")); err != nil {
+		fatal(logger, "failed to initialize database schema", err)
+	}
 
-	// Add CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	// Collect HTTP, connection pool and blog metrics
+	m := metrics.New(database)
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	// Cache hot reads in memory; services invalidate entries on writes
+	var store cache.Cache = cache.Noop{}
+	if cfg.Cache.Enabled {
+		store = cache.NewLRU(cfg.Cache.MaxEntries, int64(cfg.Cache.MaxBytes))
+	}
+	loader := cache.NewLoader(store)
 
-		c.Next()
-	})
+	// Keep uploaded media on disk or in an S3-compatible bucket
+	media, err := newMediaStorage(cfg.Media)
+	if err != nil {
+		fatal(logger, "failed to set up media storage", err)
+	}
+
+	// Initialize Gin router with request IDs, structured access logs and metrics
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(
+		otelgin.Middleware(cfg.Tracing.ServiceName),
+		middleware.RequestID(),
+		middleware.AccessLog(logging.Component(logger, "http")),
+		m.Middleware(),
+		gin.Recovery(),
+	)
+
+	// Add CORS middleware on the engine so it also answers preflight requests
+	cors := middleware.NewCORS(middleware.CORSOptions{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+	}, corsRules...)
+	router.Use(cors.Handler())
 
 	// Define routes
 	router.GET("/", func(c *gin.Context) {
@@ -65,17 +108,138 @@ func main() {
 	})
 
 	// Initialize API routes
-	initializeRoutes(router)
+	if cfg.Metrics.Enabled {
+		router.GET(cfg.Metrics.Path, gin.WrapH(m.Handler()))
+	}
+
+	// Serve locally stored media; S3 media is read from the bucket directly
+	if local, ok := media.(*storage.Local); ok {
+		router.StaticFS(cfg.Media.BaseURL, gin.Dir(local.Dir(), false))
+	}
+
+	initializeRoutes(router, cfg, database, logger, m, loader, media)
 
 	// Start the server
-	serverAddr := fmt.Sprintf(":%s", port)
-	log.Printf("Server starting on http://localhost%s", serverAddr)
-	if err := router.Run(serverAddr); err != nil {
-		log.Fatal("Failed to start server: ", err)
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           router,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
+	// Stop accepting work on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	workers := newWorkerGroup(ctx)
+
+	// Delete idempotency keys once their replay window has passed
+	idempotency := models.NewIdempotencyService(database, logging.Component(logger, "models"), cfg.Idempotency)
+	workers.Go(func(ctx context.Context) {
+		runPeriodically(ctx, cfg.Idempotency.PurgeInterval, func(ctx context.Context) {
+			if _, err := idempotency.Purge(ctx); err != nil {
+				logger.ErrorContext(ctx, "failed to purge idempotency keys", "error", err)
+			}
+		})
+	})
+
+	// Permanently delete posts that have been in the trash past retention
+	posts := models.NewPostService(database, logging.Component(logger, "models"), m, loader, cfg.Cache)
+	workers.Go(func(ctx context.Context) {
+		runPeriodically(ctx, cfg.Trash.PurgeInterval, func(ctx context.Context) {
+			if _, err := posts.PurgeExpired(ctx, cfg.Trash.Retention); err != nil {
+				logger.ErrorContext(ctx, "failed to purge trashed posts", "error", err)
+			}
+		})
+	})
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("server starting", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal(logger, "failed to start server", err)
+	case <-ctx.Done():
+		stop()
 	}
+
+	shutdown(logger, server, workers, database, shutdownTracing, cfg.Server.ShutdownTimeout)
+}
+
+// fatal logs err and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// shutdown drains in-flight requests and background workers within timeout,
+// then closes the database pool and flushes pending spans
+func shutdown(logger *slog.Logger, server *http.Server, workers *workerGroup, database *sql.DB, shutdownTracing func(context.Context) error, timeout time.Duration) {
+	logger.Info("shutting down", "drain_timeout", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("failed to drain HTTP server", "error", err)
+	}
+
+	if err := workers.Stop(ctx); err != nil {
+		logger.Error("failed to drain background workers", "error", err)
+	}
+
+	if err := database.Close(); err != nil {
+		logger.Error("failed to close database", "error", err)
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("failed to flush traces", "error", err)
+	}
+
+	logger.Info("server stopped")
+}
+
+// newMediaStorage returns the storage backend media.storage selects
+func newMediaStorage(cfg config.MediaConfig) (storage.Storage, error) {
+	if cfg.Storage == "s3" {
+		return storage.NewS3(storage.S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PublicURL: cfg.S3PublicURL,
+		})
+	}
+	return storage.NewLocal(cfg.LocalDir, cfg.BaseURL)
+}
+
+// corsRules lists the methods browsers may use on each route group
+var corsRules = []middleware.CORSRule{
+	{PathPrefix: "/", AllowedMethods: []string{"GET", "HEAD"}},
+	{PathPrefix: "/api/posts", AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}},
+	{PathPrefix: "/api/comments", AllowedMethods: []string{"GET", "HEAD", "POST", "DELETE"}},
+	{PathPrefix: "/api/tags", AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "DELETE"}},
+	{PathPrefix: "/api/categories", AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "DELETE"}},
+	{PathPrefix: "/api/series", AllowedMethods: []string{"GET", "HEAD"}},
+	{PathPrefix: "/api/authors", AllowedMethods: []string{"GET", "HEAD", "PUT"}},
+	{PathPrefix: "/api/media", AllowedMethods: []string{"GET", "HEAD", "POST", "DELETE"}},
+	{PathPrefix: "/api/admin", AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "DELETE"}},
 }
 
-func initializeRoutes(router *gin.Engine) {
+func initializeRoutes(router *gin.Engine, cfg *config.Config, database *sql.DB, logger *slog.Logger, m *metrics.Metrics, loader *cache.Loader, media storage.Storage) {
+	// Liveness and readiness probes
+	healthHandler := handlers.NewHealthHandler(database, cfg.Health, logger)
+	healthHandler.RegisterRoutes(router.Group(""))
+
 	// API routes will be defined here or imported from handlers
 	api := router.Group("/api")
 	{
@@ -88,13 +252,31 @@ func initializeRoutes(router *gin.Engine) {
 		})
 
 		// Register Blog API handlers
-		postHandler := handlers.NewPostHandler()
+		postHandler := handlers.NewPostHandler(database, logger, m, loader, cfg)
 		postHandler.RegisterRoutes(api)
 
-		commentHandler := handlers.NewCommentHandler()
+		commentHandler := handlers.NewCommentHandler(database, logger, m, loader, cfg)
 		commentHandler.RegisterRoutes(api)
 
-		tagHandler := handlers.NewTagHandler()
+		tagHandler := handlers.NewTagHandler(database, logger, m, loader, cfg)
 		tagHandler.RegisterRoutes(api)
+
+		categoryHandler := handlers.NewCategoryHandler(database, logger, m, loader, cfg)
+		categoryHandler.RegisterRoutes(api)
+
+		seriesHandler := handlers.NewSeriesHandler(database, logger, loader, cfg)
+		seriesHandler.RegisterRoutes(api)
+
+		archiveHandler := handlers.NewArchiveHandler(database, logger, m, loader, cfg)
+		archiveHandler.RegisterRoutes(api)
+
+		authorHandler := handlers.NewAuthorHandler(database, logger, m, loader, cfg)
+		authorHandler.RegisterRoutes(api)
+
+		mediaHandler := handlers.NewMediaHandler(database, logger, loader, media, cfg)
+		mediaHandler.RegisterRoutes(api)
+
+		trashHandler := handlers.NewTrashHandler(database, logger, m, loader, cfg)
+		trashHandler.RegisterRoutes(api)
 	}
 }
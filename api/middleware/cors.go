@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSOptions configures cross-origin access shared by every route
+type CORSOptions struct {
+	// AllowedOrigins lists exact origins ("https://blog.example.com") and
+	// wildcard subdomains ("https://*.example.com"); "*" allows any origin
+	// and cannot be combined with AllowCredentials
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CORSRule overrides allowed methods and headers for routes under PathPrefix
+type CORSRule struct {
+	PathPrefix     string
+	AllowedMethods []string
+	// AllowedHeaders replaces CORSOptions.AllowedHeaders when not empty
+	AllowedHeaders []string
+}
+
+// CORS applies a cross-origin resource sharing policy
+type CORS struct {
+	opts      CORSOptions
+	rules     []CORSRule
+	patterns  []originPattern
+	anyOrigin bool
+}
+
+// originPattern is a parsed entry of CORSOptions.AllowedOrigins
+type originPattern struct {
+	scheme   string
+	host     string
+	wildcard bool
+	any      bool
+}
+
+// NewCORS creates a CORS policy; rules are matched by longest path prefix
+func NewCORS(opts CORSOptions, rules ...CORSRule) *CORS {
+	c := &CORS{opts: opts, rules: rules}
+	for _, origin := range opts.AllowedOrigins {
+		p := parseOriginPattern(origin)
+		c.patterns = append(c.patterns, p)
+		c.anyOrigin = c.anyOrigin || p.any
+	}
+	return c
+}
+
+// parseOriginPattern splits an allowed origin into scheme and host
+func parseOriginPattern(origin string) originPattern {
+	if origin == "*" {
+		return originPattern{any: true}
+	}
+
+	scheme, host, _ := strings.Cut(strings.ToLower(strings.TrimSuffix(origin, "/")), "://")
+	if strings.HasPrefix(host, "*.") {
+		return originPattern{scheme: scheme, host: host[1:], wildcard: true}
+	}
+	return originPattern{scheme: scheme, host: host}
+}
+
+// allowed reports whether origin matches an allowed origin pattern
+func (c *CORS) allowed(origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+
+	for _, p := range c.patterns {
+		switch {
+		case p.any:
+			return true
+		case p.scheme != u.Scheme:
+			continue
+		case p.wildcard && strings.HasSuffix(u.Host, p.host) && len(u.Host) > len(p.host):
+			return true
+		case !p.wildcard && p.host == u.Host:
+			return true
+		}
+	}
+	return false
+}
+
+// rule returns the most specific rule for path
+func (c *CORS) rule(path string) CORSRule {
+	var best CORSRule
+	for _, r := range c.rules {
+		if strings.HasPrefix(path, r.PathPrefix) && len(r.PathPrefix) >= len(best.PathPrefix) {
+			best = r
+		}
+	}
+	return best
+}
+
+// Handler returns middleware enforcing the policy; register it on the engine
+// so that preflight requests to unregistered OPTIONS routes are handled too
+func (c *CORS) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		header := ctx.Writer.Header()
+		header.Add("Vary", "Origin")
+
+		preflight := ctx.Request.Method == http.MethodOptions &&
+			ctx.GetHeader("Access-Control-Request-Method") != ""
+
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+
+		if !c.allowed(origin) {
+			if preflight {
+				ctx.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// Serve the response without CORS headers so the browser blocks it
+			ctx.Next()
+			return
+		}
+
+		if c.anyOrigin && !c.opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if len(c.opts.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(c.opts.ExposedHeaders, ", "))
+			}
+			ctx.Next()
+			return
+		}
+
+		rule := c.rule(ctx.Request.URL.Path)
+		method := strings.ToUpper(ctx.GetHeader("Access-Control-Request-Method"))
+		if !contains(rule.AllowedMethods, method) {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		headers := rule.AllowedHeaders
+		if len(headers) == 0 {
+			headers = c.opts.AllowedHeaders
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", strings.Join(rule.AllowedMethods, ", "))
+		if len(headers) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		}
+		if c.opts.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.opts.MaxAge.Seconds())))
+		}
+
+		ctx.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// contains reports whether list holds value, ignoring case
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
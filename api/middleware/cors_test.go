@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCORSRouter(opts CORSOptions, rules ...CORSRule) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(NewCORS(opts, rules...).Handler())
+	router.GET("/api/posts", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/api/tags", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func TestCORS(t *testing.T) {
+	opts := CORSOptions{
+		AllowedOrigins:   []string{"https://blog.example.org", "https://*.example.com"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	rules := []CORSRule{
+		{PathPrefix: "/", AllowedMethods: []string{"GET", "HEAD"}},
+		{PathPrefix: "/api/posts", AllowedMethods: []string{"GET", "POST", "PUT"}, AllowedHeaders: []string{"Content-Type", "If-Match"}},
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		origin        string
+		requestMethod string
+		wantStatus    int
+		wantOrigin    string
+		wantHeaders   map[string]string
+	}{
+		{
+			name:       "exact origin",
+			method:     http.MethodGet,
+			path:       "/api/posts",
+			origin:     "https://blog.example.org",
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://blog.example.org",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "ETag",
+			},
+		},
+		{
+			name:       "wildcard subdomain",
+			method:     http.MethodGet,
+			path:       "/api/posts",
+			origin:     "https://admin.example.com",
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://admin.example.com",
+		},
+		{
+			name:       "wildcard does not match the bare domain",
+			method:     http.MethodGet,
+			path:       "/api/posts",
+			origin:     "https://example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wildcard does not match a lookalike domain",
+			method:     http.MethodGet,
+			path:       "/api/posts",
+			origin:     "https://evil-example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wildcard requires the same scheme",
+			method:     http.MethodGet,
+			path:       "/api/posts",
+			origin:     "http://admin.example.com",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "rejected origin",
+			method:     http.MethodGet,
+			path:       "/api/posts",
+			origin:     "https://attacker.test",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "preflight uses the route's methods and headers",
+			method:        http.MethodOptions,
+			path:          "/api/posts/abc",
+			origin:        "https://blog.example.org",
+			requestMethod: "PUT",
+			wantStatus:    http.StatusNoContent,
+			wantOrigin:    "https://blog.example.org",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Methods":     "GET, POST, PUT",
+				"Access-Control-Allow-Headers":     "Content-Type, If-Match",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name:          "preflight falls back to the shared headers",
+			method:        http.MethodOptions,
+			path:          "/api/tags",
+			origin:        "https://admin.example.com",
+			requestMethod: "GET",
+			wantStatus:    http.StatusNoContent,
+			wantOrigin:    "https://admin.example.com",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "GET, HEAD",
+				"Access-Control-Allow-Headers": "Content-Type, Authorization",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:          "preflight for a method the route does not allow",
+			method:        http.MethodOptions,
+			path:          "/api/tags",
+			origin:        "https://blog.example.org",
+			requestMethod: "DELETE",
+			wantStatus:    http.StatusForbidden,
+			wantOrigin:    "https://blog.example.org",
+		},
+		{
+			name:          "preflight from a rejected origin",
+			method:        http.MethodOptions,
+			path:          "/api/posts",
+			origin:        "https://evil-example.com",
+			requestMethod: "GET",
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:       "same-origin request",
+			method:     http.MethodGet,
+			path:       "/api/posts",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	router := newCORSRouter(opts, rules...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.wantOrigin == "" && rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Error("Access-Control-Allow-Credentials set for a rejected origin")
+			}
+			if !containsValue(rec.Header().Values("Vary"), "Origin") {
+				t.Errorf("Vary = %v, want it to include Origin", rec.Header().Values("Vary"))
+			}
+			for name, want := range tt.wantHeaders {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials bool
+		wantOrigin  string
+	}{
+		{name: "without credentials", credentials: false, wantOrigin: "*"},
+		{name: "with credentials echoes the origin", credentials: true, wantOrigin: "https://anywhere.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newCORSRouter(CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: tt.credentials})
+			req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+			req.Header.Set("Origin", "https://anywhere.test")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+		})
+	}
+}
+
+// containsValue reports whether any comma-separated header value is want
+func containsValue(values []string, want string) bool {
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if strings.TrimSpace(item) == want {
+				return true
+			}
+		}
+	}
+	return false
+}
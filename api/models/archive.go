@@ -0,0 +1,82 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/biboy/blog/api/cache"
+)
+
+// ArchiveYear counts the published posts of one year, broken down by month
+type ArchiveYear struct {
+	Year   int            `json:"year"`
+	Count  int            `json:"count"`
+	Months []ArchiveMonth `json:"months"`
+}
+
+// ArchiveMonth counts the published posts of one month
+type ArchiveMonth struct {
+	Month int `json:"month"`
+	Count int `json:"count"`
+}
+
+// GetArchive counts published posts per month in loc, newest first,
+// skipping months without posts
+func (s *PostService) GetArchive(ctx context.Context, loc *time.Location) ([]ArchiveYear, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetArchive")
+	defer span.End()
+
+	return cache.Load(ctx, s.cache, archiveKey, s.ttl.ListTTL, func(ctx context.Context) ([]ArchiveYear, error) {
+		return s.loadArchive(ctx, loc)
+	})
+}
+
+// loadArchive reads the monthly counts from the database
+func (s *PostService) loadArchive(ctx context.Context, loc *time.Location) ([]ArchiveYear, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT
+			EXTRACT(YEAR FROM created_at AT TIME ZONE $1)::int AS year,
+			EXTRACT(MONTH FROM created_at AT TIME ZONE $1)::int AS month,
+			COUNT(*)
+		FROM posts
+		WHERE published AND deleted_at IS NULL
+		GROUP BY year, month
+		ORDER BY year DESC, month DESC
+	`, loc.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	years := []ArchiveYear{}
+	for rows.Next() {
+		var year int
+		var month ArchiveMonth
+		if err := rows.Scan(&year, &month.Month, &month.Count); err != nil {
+			return nil, err
+		}
+
+		if len(years) == 0 || years[len(years)-1].Year != year {
+			years = append(years, ArchiveYear{Year: year})
+		}
+		last := &years[len(years)-1]
+		last.Count += month.Count
+		last.Months = append(last.Months, month)
+	}
+
+	return years, rows.Err()
+}
+
+// GetPublishedInMonth retrieves a page of the posts published in a month
+// of loc, newest first, along with how many there are in total
+func (s *PostService) GetPublishedInMonth(ctx context.Context, loc *time.Location, year int, month time.Month, page, limit int) ([]Post, int, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetPublishedInMonth")
+	defer span.End()
+
+	start := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	end := start.AddDate(0, 1, 0)
+	bounds := fmt.Sprintf("[%s,%s)", start.Format(time.RFC3339), end.Format(time.RFC3339))
+
+	return s.listPublished(ctx, `p.created_at <@ $1::tstzrange`, bounds, page, limit)
+}
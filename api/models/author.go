@@ -0,0 +1,199 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+)
+
+// AuthorProfile is the public profile of someone who has written posts or
+// comments; unlike Author it never carries an email address
+type AuthorProfile struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Picture      string            `json:"picture"`
+	Bio          string            `json:"bio"`
+	Links        map[string]string `json:"links"`
+	PostCount    int               `json:"postCount"`
+	CommentCount int               `json:"commentCount"`
+}
+
+// PublicAuthor is the part of an Author that public pages show; it leaves
+// out the email address and admin flag
+type PublicAuthor struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+}
+
+// PublicComment is a Comment whose author is a PublicAuthor
+type PublicComment struct {
+	Comment
+	Author PublicAuthor `json:"author"`
+}
+
+// PublicPost is a Post whose author and commenters are PublicAuthors. Its
+// fields shadow those of the embedded Post when encoded as JSON.
+type PublicPost struct {
+	Post
+	Author   PublicAuthor    `json:"author"`
+	Comments []PublicComment `json:"comments,omitempty"`
+}
+
+// publicAuthor projects an Author onto a PublicAuthor
+func publicAuthor(author Author) PublicAuthor {
+	return PublicAuthor{ID: author.ID, Name: author.Name, Picture: author.Picture}
+}
+
+// PublicPosts projects posts for pages that must not expose email
+// addresses, such as author profiles
+func PublicPosts(posts []Post) []PublicPost {
+	public := make([]PublicPost, len(posts))
+	for i, post := range posts {
+		public[i] = PublicPost{Post: post, Author: publicAuthor(post.Author)}
+		if len(post.Comments) > 0 {
+			public[i].Comments = make([]PublicComment, len(post.Comments))
+			for j, comment := range post.Comments {
+				public[i].Comments[j] = PublicComment{Comment: comment, Author: publicAuthor(comment.Author)}
+			}
+		}
+	}
+	return public
+}
+
+// AuthorProfileData represents the parts of a profile an author can edit;
+// Links maps a site name such as "github" to a URL
+type AuthorProfileData struct {
+	Bio   string            `json:"bio"`
+	Links map[string]string `json:"links"`
+}
+
+// AuthorService provides methods to read and edit author profiles
+type AuthorService struct {
+	DB  *sql.DB
+	log *slog.Logger
+}
+
+// NewAuthorService creates a new author service
+func NewAuthorService(db *sql.DB, logger *slog.Logger) *AuthorService {
+	return &AuthorService{DB: db, log: logger}
+}
+
+// authoredBy matches posts p written by users u, alone or as a co-author
+const authoredBy = `(p.author_id = u.id OR p.id IN (SELECT post_id FROM post_coauthors WHERE user_id = u.id))`
+
+// authorProfileColumns selects a profile from users u; post and comment
+// counts only include published, live posts and comments on them
+const authorProfileColumns = `
+	u.id, u.name, u.picture, u.bio, u.links,
+	(SELECT COUNT(*) FROM posts p WHERE ` + authoredBy + ` AND p.published AND p.deleted_at IS NULL),
+	(SELECT COUNT(*) FROM comments c JOIN posts p ON p.id = c.post_id
+		WHERE c.author_id = u.id AND p.published AND p.deleted_at IS NULL)
+`
+
+// GetAll retrieves the profiles of everyone with a published post, by name
+func (s *AuthorService) GetAll(ctx context.Context) ([]AuthorProfile, error) {
+	ctx, span := tracer.Start(ctx, "AuthorService.GetAll")
+	defer span.End()
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+authorProfileColumns+`
+		FROM users u
+		WHERE EXISTS (SELECT 1 FROM posts p WHERE `+authoredBy+` AND p.published AND p.deleted_at IS NULL)
+		ORDER BY u.name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []AuthorProfile{}
+	for rows.Next() {
+		author, err := scanAuthorProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		authors = append(authors, author)
+	}
+
+	return authors, rows.Err()
+}
+
+// GetByID retrieves one author's profile
+func (s *AuthorService) GetByID(ctx context.Context, id string) (AuthorProfile, error) {
+	ctx, span := tracer.Start(ctx, "AuthorService.GetByID")
+	defer span.End()
+
+	return scanAuthorProfile(s.DB.QueryRowContext(ctx, `
+		SELECT `+authorProfileColumns+`
+		FROM users u
+		WHERE u.id = $1
+	`, id))
+}
+
+// UpdateProfile replaces an author's bio and links; it returns
+// sql.ErrNoRows when no such user exists
+func (s *AuthorService) UpdateProfile(ctx context.Context, id string, data AuthorProfileData) (AuthorProfile, error) {
+	ctx, span := tracer.Start(ctx, "AuthorService.UpdateProfile")
+	defer span.End()
+
+	links := data.Links
+	if links == nil {
+		links = map[string]string{}
+	}
+	encoded, err := json.Marshal(links)
+	if err != nil {
+		return AuthorProfile{}, err
+	}
+
+	result, err := s.DB.ExecContext(ctx, `
+		UPDATE users SET bio = $1, links = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3
+	`, data.Bio, string(encoded), id)
+	if err != nil {
+		return AuthorProfile{}, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return AuthorProfile{}, err
+	}
+	if updated == 0 {
+		return AuthorProfile{}, sql.ErrNoRows
+	}
+
+	s.log.InfoContext(ctx, "author profile updated", "user_id", id, "links", len(links))
+	return s.GetByID(ctx, id)
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanAuthorProfile reads a row selected with authorProfileColumns
+func scanAuthorProfile(row scanner) (AuthorProfile, error) {
+	var author AuthorProfile
+	var links []byte
+	if err := row.Scan(
+		&author.ID, &author.Name, &author.Picture, &author.Bio, &links, &author.PostCount, &author.CommentCount,
+	); err != nil {
+		return author, err
+	}
+
+	if err := json.Unmarshal(links, &author.Links); err != nil {
+		return author, err
+	}
+	return author, nil
+}
+
+// GetPublishedByAuthor retrieves a page of the published posts an author
+// wrote or co-wrote, newest first, along with how many there are in total
+func (s *PostService) GetPublishedByAuthor(ctx context.Context, authorID string, page, limit int) ([]Post, int, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetPublishedByAuthor")
+	defer span.End()
+
+	return s.listPublished(ctx, `(p.author_id = $1 OR p.id IN (
+		SELECT post_id FROM post_coauthors WHERE user_id = $1
+	))`, authorID, page, limit)
+}
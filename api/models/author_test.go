@@ -0,0 +1,42 @@
+package models_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/biboy/blog/api/models"
+)
+
+func TestPublicPostsOmitEmail(t *testing.T) {
+	posts := []models.Post{{
+		ID:     "p1",
+		Title:  "Hello",
+		Author: models.Author{ID: "u1", Email: "author@example.com", Name: "Ada", Picture: "a.png", IsAdmin: true},
+		Comments: []models.Comment{{
+			ID:     "c1",
+			Author: models.Author{ID: "u2", Email: "reader@example.com", Name: "Bob"},
+		}},
+	}}
+
+	data, err := json.Marshal(models.PublicPosts(posts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(data)
+
+	for _, leaked := range []string{`"email"`, "@example.com", `"isAdmin"`} {
+		if strings.Contains(body, leaked) {
+			t.Errorf("encoded posts contain %s: %s", leaked, body)
+		}
+	}
+	for _, want := range []string{`"name":"Ada"`, `"picture":"a.png"`, `"name":"Bob"`, `"title":"Hello"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("encoded posts lack %s: %s", want, body)
+		}
+	}
+
+	if posts[0].Author.Email == "" || posts[0].Comments[0].Author.Email == "" {
+		t.Error("PublicPosts modified the posts it projected")
+	}
+}
@@ -0,0 +1,31 @@
+package models
+
+import "fmt"
+
+// Cache keys for the responses cached by the services. Writers invalidate
+// exactly the keys their change can affect.
+const (
+	postPagePrefix    = "posts:page:"
+	postSlugPrefix    = "post:slug:"
+	postRelatedPrefix = "post:related:"
+	archiveKey        = "posts:archive"
+	tagsKey           = "tags:all"
+	tagCountsKey      = "tags:counts"
+
+	categoryTreeKey = "categories:tree"
+)
+
+// postPageKey identifies one page of GetAll
+func postPageKey(page, limit int) string {
+	return fmt.Sprintf("%s%d:%d", postPagePrefix, page, limit)
+}
+
+// postSlugKey identifies a post fetched by GetBySlug
+func postSlugKey(slug string) string {
+	return postSlugPrefix + slug
+}
+
+// postRelatedKey identifies the related posts of a post fetched by GetRelated
+func postRelatedKey(id string, limit int) string {
+	return fmt.Sprintf("%s%s:%d", postRelatedPrefix, id, limit)
+}
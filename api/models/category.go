@@ -0,0 +1,381 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/lib/pq"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+)
+
+var (
+	// ErrCategoryNotFound is returned when a referenced category does not exist
+	ErrCategoryNotFound = errors.New("category not found")
+	// ErrCategorySlugTaken is returned when a category slug is already in use
+	ErrCategorySlugTaken = errors.New("category slug is already in use")
+	// ErrCategoryCycle is returned when reparenting would put a category
+	// under itself or one of its descendants
+	ErrCategoryCycle = errors.New("category cannot be moved under itself or its descendants")
+	// ErrCategoryHasChildren is returned when deleting a category that still has subcategories
+	ErrCategoryHasChildren = errors.New("category has subcategories")
+)
+
+// Category is a node in the tree of blog sections
+type Category struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Slug        string     `json:"slug"`
+	Description string     `json:"description"`
+	ParentID    *string    `json:"parentId"`
+	Position    int        `json:"position"`
+	Children    []Category `json:"children,omitempty"`
+}
+
+// CategoryRef is the summary of a post's primary category embedded in posts
+type CategoryRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// CategoryFormData represents the form data for creating/updating a
+// category; an empty slug is derived from the name on create and kept on
+// update, and an empty parent ID makes a top-level category
+type CategoryFormData struct {
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	ParentID    string `json:"parentId"`
+	Position    int    `json:"position"`
+}
+
+// CategoryService provides methods to interact with categories in the database
+type CategoryService struct {
+	DB    *sql.DB
+	log   *slog.Logger
+	cache *cache.Loader
+	ttl   config.CacheConfig
+}
+
+// NewCategoryService creates a new category service
+func NewCategoryService(db *sql.DB, logger *slog.Logger, loader *cache.Loader, ttl config.CacheConfig) *CategoryService {
+	return &CategoryService{DB: db, log: logger, cache: loader, ttl: ttl}
+}
+
+// Tree retrieves every category nested under its parent, siblings ordered
+// by position and then name
+func (s *CategoryService) Tree(ctx context.Context) ([]Category, error) {
+	ctx, span := tracer.Start(ctx, "CategoryService.Tree")
+	defer span.End()
+
+	return cache.Load(ctx, s.cache, categoryTreeKey, s.ttl.CategoriesTTL, s.loadTree)
+}
+
+// loadTree reads every category and assembles the tree
+func (s *CategoryService) loadTree(ctx context.Context) ([]Category, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, name, slug, description, parent_id, position
+		FROM categories
+		ORDER BY position ASC, name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var category Category
+		if err := rows.Scan(
+			&category.ID, &category.Name, &category.Slug, &category.Description, &category.ParentID, &category.Position,
+		); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	children := make(map[string][]Category)
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var attach func(category Category) Category
+	attach = func(category Category) Category {
+		for _, child := range children[category.ID] {
+			category.Children = append(category.Children, attach(child))
+		}
+		return category
+	}
+
+	roots := []Category{}
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, attach(category))
+		}
+	}
+	return roots, nil
+}
+
+// GetByID retrieves a category by its ID, without its children
+func (s *CategoryService) GetByID(ctx context.Context, id string) (Category, error) {
+	ctx, span := tracer.Start(ctx, "CategoryService.GetByID")
+	defer span.End()
+
+	var category Category
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, name, slug, description, parent_id, position
+		FROM categories
+		WHERE id = $1
+	`, id).Scan(&category.ID, &category.Name, &category.Slug, &category.Description, &category.ParentID, &category.Position)
+	return category, err
+}
+
+// GetBySlug retrieves a category by its slug, without its children
+func (s *CategoryService) GetBySlug(ctx context.Context, slug string) (Category, error) {
+	ctx, span := tracer.Start(ctx, "CategoryService.GetBySlug")
+	defer span.End()
+
+	var category Category
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, name, slug, description, parent_id, position
+		FROM categories
+		WHERE slug = $1
+	`, slug).Scan(&category.ID, &category.Name, &category.Slug, &category.Description, &category.ParentID, &category.Position)
+	return category, err
+}
+
+// Create adds a new category; it returns ErrCategoryNotFound when the
+// parent does not exist and ErrCategorySlugTaken when an explicit slug is
+// in use. A slug derived from the name is numbered instead, as for tags.
+func (s *CategoryService) Create(ctx context.Context, data CategoryFormData) (Category, error) {
+	ctx, span := tracer.Start(ctx, "CategoryService.Create")
+	defer span.End()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Category{}, err
+	}
+
+	if err := lockSlugs(ctx, tx, "categories"); err != nil {
+		tx.Rollback()
+		return Category{}, err
+	}
+
+	// A derived slug is numbered like a tag's when taken; an explicit one
+	// must be free
+	name := NormalizeName(data.Name)
+	slug := data.Slug
+	if slug == "" {
+		if slug, err = availableSlug(ctx, tx, "categories", slugify(name, "category")); err != nil {
+			tx.Rollback()
+			return Category{}, err
+		}
+	}
+
+	var category Category
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO categories (id, name, slug, description, parent_id, position)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING id, name, slug, description, parent_id, position
+	`, generateID(), name, slug, data.Description, data.ParentID, data.Position).Scan(
+		&category.ID, &category.Name, &category.Slug, &category.Description, &category.ParentID, &category.Position,
+	)
+	if err != nil {
+		tx.Rollback()
+		return category, categoryConflict(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return category, categoryConflict(err)
+	}
+
+	s.cache.Invalidate(ctx, categoryTreeKey)
+
+	s.log.InfoContext(ctx, "category created", "category_id", category.ID, "slug", category.Slug)
+	return category, nil
+}
+
+// Update modifies a category and may move it under another parent. It
+// returns ErrCategoryCycle when the new parent is the category itself or
+// one of its descendants.
+func (s *CategoryService) Update(ctx context.Context, id string, data CategoryFormData) (Category, error) {
+	ctx, span := tracer.Start(ctx, "CategoryService.Update")
+	defer span.End()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Category{}, err
+	}
+
+	// Serialize writers so two concurrent moves cannot together form a cycle
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		tx.Rollback()
+		return Category{}, err
+	}
+
+	if data.ParentID != "" {
+		var cycle bool
+		err := tx.QueryRowContext(ctx, `
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id FROM categories WHERE id = $1
+				UNION ALL
+				SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+			)
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)
+		`, data.ParentID, id).Scan(&cycle)
+		if err != nil {
+			tx.Rollback()
+			return Category{}, err
+		}
+		if cycle {
+			tx.Rollback()
+			return Category{}, ErrCategoryCycle
+		}
+	}
+
+	// An empty slug keeps the current one so that category links stay stable
+	var category Category
+	err = tx.QueryRowContext(ctx, `
+		UPDATE categories
+		SET name = $1, slug = COALESCE(NULLIF($2, ''), slug), description = $3, parent_id = NULLIF($4, ''), position = $5
+		WHERE id = $6
+		RETURNING id, name, slug, description, parent_id, position
+	`, NormalizeName(data.Name), data.Slug, data.Description, data.ParentID, data.Position, id).Scan(
+		&category.ID, &category.Name, &category.Slug, &category.Description, &category.ParentID, &category.Position,
+	)
+	if err != nil {
+		tx.Rollback()
+		return Category{}, categoryConflict(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Category{}, err
+	}
+
+	if err := s.invalidatePostsInCategory(ctx, id); err != nil {
+		return category, err
+	}
+
+	s.log.InfoContext(ctx, "category updated", "category_id", category.ID, "slug", category.Slug)
+	return category, nil
+}
+
+// Delete removes a category; posts in it are left without a primary
+// category. It returns ErrCategoryHasChildren while subcategories exist.
+func (s *CategoryService) Delete(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "CategoryService.Delete")
+	defer span.End()
+
+	// Invalidate before the delete clears the posts' category
+	if err := s.invalidatePostsInCategory(ctx, id); err != nil {
+		return err
+	}
+
+	result, err := s.DB.ExecContext(ctx, `
+		DELETE FROM categories WHERE id = $1
+	`, id)
+	if isForeignKeyViolation(err) {
+		return ErrCategoryHasChildren
+	}
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	s.log.InfoContext(ctx, "category deleted", "category_id", id)
+	return nil
+}
+
+// invalidatePostsInCategory drops the cached tree and every cached post
+// whose primary category is id
+func (s *CategoryService) invalidatePostsInCategory(ctx context.Context, id string) error {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT slug FROM posts WHERE category_id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := []string{categoryTreeKey}
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return err
+		}
+		keys = append(keys, postSlugKey(slug))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) > 1 {
+		s.cache.InvalidatePrefix(ctx, postPagePrefix)
+	}
+	s.cache.Invalidate(ctx, keys...)
+	return nil
+}
+
+// categoryRef looks up the summary of a post's category; an empty id
+// means no category. It returns ErrCategoryNotFound for unknown IDs.
+func categoryRef(ctx context.Context, q queryer, id string) (*CategoryRef, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	var ref CategoryRef
+	err := q.QueryRowContext(ctx, `
+		SELECT id, name, slug FROM categories WHERE id = $1
+	`, id).Scan(&ref.ID, &ref.Name, &ref.Slug)
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// categoryRefFrom builds a post's category from columns read with a LEFT JOIN
+func categoryRefFrom(id, name, slug sql.NullString) *CategoryRef {
+	if !id.Valid {
+		return nil
+	}
+	return &CategoryRef{ID: id.String, Name: name.String, Slug: slug.String}
+}
+
+// categoryConflict maps constraint violations on writes to categories to
+// ErrCategorySlugTaken or, for a missing parent, ErrCategoryNotFound
+func categoryConflict(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505":
+			return ErrCategorySlugTaken
+		case "23503":
+			return ErrCategoryNotFound
+		}
+	}
+	return err
+}
+
+// isForeignKeyViolation reports whether err is a Postgres foreign_key_violation
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
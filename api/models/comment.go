@@ -1,8 +1,13 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"log/slog"
 	"time"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/metrics"
 )
 
 // Comment represents a blog comment
@@ -21,22 +26,30 @@ type CommentFormData struct {
 
 // CommentService provides methods to interact with comments in the database
 type CommentService struct {
-	DB *sql.DB
+	DB      *sql.DB
+	log     *slog.Logger
+	metrics *metrics.Metrics
+	cache   *cache.Loader
 }
 
 // NewCommentService creates a new comment service
-func NewCommentService(db *sql.DB) *CommentService {
-	return &CommentService{DB: db}
+func NewCommentService(db *sql.DB, logger *slog.Logger, m *metrics.Metrics, loader *cache.Loader) *CommentService {
+	return &CommentService{DB: db, log: logger, metrics: m, cache: loader}
 }
 
-// GetByPostID retrieves all comments for a post
-func (s *CommentService) GetByPostID(postID string) ([]Comment, error) {
-	rows, err := s.DB.Query(`
+// GetByPostID retrieves all comments for a post; a trashed post has none
+func (s *CommentService) GetByPostID(ctx context.Context, postID string) ([]Comment, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.GetByPostID")
+	defer span.End()
+
+	rows, err := s.DB.QueryContext(ctx, `
 		SELECT 
 			c.id, c.content, c.created_at, c.post_id,
-			c.author_id, c.author_email, c.author_name, c.author_picture, c.author_is_admin
+			u.id, u.email, u.name, u.picture, u.is_admin
 		FROM comments c
-		WHERE c.post_id = $1
+		JOIN posts p ON p.id = c.post_id
+		JOIN users u ON u.id = c.author_id
+		WHERE c.post_id = $1 AND p.deleted_at IS NULL
 		ORDER BY c.created_at DESC
 	`, postID)
 
@@ -61,36 +74,84 @@ func (s *CommentService) GetByPostID(postID string) ([]Comment, error) {
 }
 
 // Create adds a new comment to a post
-func (s *CommentService) Create(postID string, commentData CommentFormData, author Author) (Comment, error) {
+func (s *CommentService) Create(ctx context.Context, postID string, commentData CommentFormData, author Author) (Comment, error) {
+	ctx, span := tracer.Start(ctx, "CommentService.Create")
+	defer span.End()
+
 	commentID := generateID()
 
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	author, profileChanged, err := upsertUser(ctx, tx, author)
+	if err != nil {
+		tx.Rollback()
+		return Comment{}, err
+	}
+
+	// Inserting from posts yields no row, and so sql.ErrNoRows, when the
+	// post does not exist or is in the trash
 	var comment Comment
-	err := s.DB.QueryRow(`
-		INSERT INTO comments (
-			id, content, created_at, post_id,
-			author_id, author_email, author_name, author_picture, author_is_admin
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id, content, created_at, post_id
+	var postSlug sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO comments (id, content, created_at, post_id, author_id)
+		SELECT $1, $2, $3::timestamptz, p.id, $5
+		FROM posts p
+		WHERE p.id = $4 AND p.deleted_at IS NULL
+		RETURNING id, content, created_at, post_id, (SELECT slug FROM posts WHERE id = $4)
 	`,
-		commentID, commentData.Content, time.Now(), postID,
-		author.ID, author.Email, author.Name, author.Picture, author.IsAdmin,
+		commentID, commentData.Content, time.Now(), postID, author.ID,
 	).Scan(
-		&comment.ID, &comment.Content, &comment.CreatedAt, &comment.PostID,
+		&comment.ID, &comment.Content, &comment.CreatedAt, &comment.PostID, &postSlug,
 	)
 
 	if err != nil {
+		tx.Rollback()
 		return Comment{}, err
 	}
 
+	if err := tx.Commit(); err != nil {
+		return Comment{}, err
+	}
+
+	// Posts embed their comments, both singly and in lists
+	s.cache.InvalidatePrefix(ctx, postPagePrefix)
+	s.cache.Invalidate(ctx, postSlugKey(postSlug.String))
+	if profileChanged {
+		invalidateProfiles(ctx, s.cache)
+	}
+
 	comment.Author = author
+	s.metrics.CommentCreated()
 
+	s.log.InfoContext(ctx, "comment created", "comment_id", comment.ID, "post_id", comment.PostID)
 	return comment, nil
 }
 
 // Delete removes a comment
-func (s *CommentService) Delete(id string) error {
-	_, err := s.DB.Exec(`
-		DELETE FROM comments WHERE id = $1
-	`, id)
-	return err
+func (s *CommentService) Delete(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "CommentService.Delete")
+	defer span.End()
+
+	var postSlug string
+	err := s.DB.QueryRowContext(ctx, `
+		DELETE FROM comments c
+		USING posts p
+		WHERE c.id = $1 AND p.id = c.post_id
+		RETURNING p.slug
+	`, id).Scan(&postSlug)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.cache.InvalidatePrefix(ctx, postPagePrefix)
+	s.cache.Invalidate(ctx, postSlugKey(postSlug))
+
+	s.log.InfoContext(ctx, "comment deleted", "comment_id", id)
+	return nil
 }
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/biboy/blog/api/config"
+)
+
+// ErrIdempotencyKeyReused is returned when a key is replayed with a different request
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
+// ErrIdempotencyKeyInFlight is returned while the first request for a key is still running
+var ErrIdempotencyKeyInFlight = errors.New("a request with this idempotency key is still in progress")
+
+// StoredResponse is the first response recorded for an idempotency key;
+// ETag is its ETag header, empty when it had none
+type StoredResponse struct {
+	StatusCode int
+	Body       []byte
+	ETag       string
+}
+
+// IdempotencyService records responses to create requests so that retries
+// carrying the same Idempotency-Key replay them instead of creating twice
+type IdempotencyService struct {
+	DB  *sql.DB
+	log *slog.Logger
+	cfg config.IdempotencyConfig
+}
+
+// NewIdempotencyService creates a new idempotency service whose keys expire
+// after cfg.TTL
+func NewIdempotencyService(db *sql.DB, logger *slog.Logger, cfg config.IdempotencyConfig) *IdempotencyService {
+	return &IdempotencyService{DB: db, log: logger, cfg: cfg}
+}
+
+// Reserve claims key for userID. It returns nil when the caller should run
+// the request, or the stored response when the key was already completed.
+// A live key with a different requestHash yields ErrIdempotencyKeyReused.
+// The claim is a lease: if it is not completed within cfg.Lease, e.g.
+// because the process died, a retry of the same request takes it over.
+func (s *IdempotencyService) Reserve(ctx context.Context, userID, key, requestHash string) (*StoredResponse, error) {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.Reserve")
+	defer span.End()
+
+	// Expired keys are taken over as if they had never been used, and
+	// abandoned claims by a retry of the same request
+	var claimed bool
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, request_hash, expires_at, locked_until)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4), CURRENT_TIMESTAMP + make_interval(secs => $5))
+		ON CONFLICT (user_id, key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			status_code = NULL,
+			response_body = NULL,
+			etag = '',
+			created_at = CURRENT_TIMESTAMP,
+			expires_at = EXCLUDED.expires_at,
+			locked_until = EXCLUDED.locked_until
+		WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+			OR (idempotency_keys.status_code IS NULL
+				AND idempotency_keys.locked_until <= CURRENT_TIMESTAMP
+				AND idempotency_keys.request_hash = EXCLUDED.request_hash)
+		RETURNING true
+	`, userID, key, requestHash, s.cfg.TTL.Seconds(), s.cfg.Lease.Seconds()).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var storedHash string
+	var statusCode sql.NullInt64
+	var body []byte
+	var etag string
+	err = s.DB.QueryRowContext(ctx, `
+		SELECT request_hash, status_code, response_body, etag
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`, userID, key).Scan(&storedHash, &statusCode, &body, &etag)
+	if err == sql.ErrNoRows {
+		// The first request failed and released the key between our two queries
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if storedHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !statusCode.Valid {
+		return nil, ErrIdempotencyKeyInFlight
+	}
+
+	s.log.DebugContext(ctx, "replaying idempotent response", "user_id", userID, "idempotency_key", key)
+	return &StoredResponse{StatusCode: int(statusCode.Int64), Body: body, ETag: etag}, nil
+}
+
+// Complete stores the response for a key claimed with Reserve
+func (s *IdempotencyService) Complete(ctx context.Context, userID, key string, response StoredResponse) error {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.Complete")
+	defer span.End()
+
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $3, response_body = $4, etag = $5, locked_until = NULL
+		WHERE user_id = $1 AND key = $2
+	`, userID, key, response.StatusCode, response.Body, response.ETag)
+	return err
+}
+
+// Release frees a key claimed with Reserve whose request failed, so a retry can run it again
+func (s *IdempotencyService) Release(ctx context.Context, userID, key string) error {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.Release")
+	defer span.End()
+
+	_, err := s.DB.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND status_code IS NULL
+	`, userID, key)
+	return err
+}
+
+// Purge deletes expired keys and returns how many were removed
+func (s *IdempotencyService) Purge(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "IdempotencyService.Purge")
+	defer span.End()
+
+	result, err := s.DB.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		s.log.InfoContext(ctx, "expired idempotency keys purged", "count", purged)
+	}
+	return purged, nil
+}
@@ -0,0 +1,282 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"image"
+	"log/slog"
+	"net/http"
+	"time"
+
+	// Register the decoders image.DecodeConfig needs
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/storage"
+)
+
+var (
+	// ErrUnsupportedMedia is returned for uploads that are not PNG, JPEG,
+	// GIF or WebP images, whatever their file name or declared type says
+	ErrUnsupportedMedia = errors.New("unsupported media type")
+	// ErrMediaInUse is returned when deleting media that posts still reference
+	ErrMediaInUse = errors.New("media is used by posts")
+)
+
+// mediaTypes maps the content types accepted for upload to file extensions
+var mediaTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Media is an uploaded file that posts can embed by URL
+type Media struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	UploaderID  string    `json:"uploaderId"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// UsageCount is how many posts, including trashed ones, embed the URL
+	UsageCount int `json:"usageCount"`
+}
+
+// MediaService provides methods to upload and manage media
+type MediaService struct {
+	DB      *sql.DB
+	log     *slog.Logger
+	cache   *cache.Loader
+	storage storage.Storage
+}
+
+// NewMediaService creates a new media service storing files in store
+func NewMediaService(db *sql.DB, logger *slog.Logger, loader *cache.Loader, store storage.Storage) *MediaService {
+	return &MediaService{DB: db, log: logger, cache: loader, storage: store}
+}
+
+// Upload stores an image and records it. The type is sniffed from the
+// content; anything but a PNG, JPEG, GIF or WebP image whose dimensions
+// can be read yields ErrUnsupportedMedia.
+func (s *MediaService) Upload(ctx context.Context, filename string, data []byte, uploader Author) (Media, error) {
+	ctx, span := tracer.Start(ctx, "MediaService.Upload")
+	defer span.End()
+
+	contentType := http.DetectContentType(data)
+	ext, ok := mediaTypes[contentType]
+	if !ok {
+		return Media{}, ErrUnsupportedMedia
+	}
+	width, height, err := imageSize(contentType, data)
+	if err != nil {
+		return Media{}, ErrUnsupportedMedia
+	}
+
+	id := generateID()
+	key := time.Now().UTC().Format("2006/01/") + id + ext
+	if err := s.storage.Put(ctx, key, contentType, data); err != nil {
+		return Media{}, err
+	}
+
+	media, profileChanged, err := s.insert(ctx, Media{
+		ID:          id,
+		URL:         s.storage.URL(key),
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       width,
+		Height:      height,
+		UploaderID:  uploader.ID,
+	}, key, uploader)
+	if err != nil {
+		// Do not leave a file behind that nothing records
+		if err := s.storage.Delete(ctx, key); err != nil {
+			s.log.WarnContext(ctx, "failed to remove unrecorded media file", "key", key, "error", err)
+		}
+		return Media{}, err
+	}
+
+	if profileChanged {
+		invalidateProfiles(ctx, s.cache)
+	}
+
+	s.log.InfoContext(ctx, "media uploaded", "media_id", media.ID, "content_type", contentType, "size", media.Size)
+	return media, nil
+}
+
+// insert records uploaded media along with its uploader's profile
+func (s *MediaService) insert(ctx context.Context, media Media, key string, uploader Author) (Media, bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return media, false, err
+	}
+
+	_, profileChanged, err := upsertUser(ctx, tx, uploader)
+	if err != nil {
+		tx.Rollback()
+		return media, false, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO media (id, storage_key, url, filename, content_type, size, width, height, uploader_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at
+	`,
+		media.ID, key, media.URL, media.Filename, media.ContentType, media.Size, media.Width, media.Height,
+		media.UploaderID, time.Now(),
+	).Scan(&media.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return media, false, err
+	}
+
+	return media, profileChanged, tx.Commit()
+}
+
+// GetAll retrieves a page of media, newest first, with how many posts use
+// each, along with how much media there is in total
+func (s *MediaService) GetAll(ctx context.Context, page, limit int) ([]Media, int, error) {
+	ctx, span := tracer.Start(ctx, "MediaService.GetAll")
+	defer span.End()
+
+	offset := (page - 1) * limit
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.url, m.filename, m.content_type, m.size, m.width, m.height, m.uploader_id, m.created_at,
+			(SELECT COUNT(*) FROM posts p WHERE strpos(p.content, m.url) > 0),
+			COUNT(*) OVER ()
+		FROM media m
+		ORDER BY m.created_at DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	media := []Media{}
+	total := 0
+	for rows.Next() {
+		var item Media
+		if err := rows.Scan(
+			&item.ID, &item.URL, &item.Filename, &item.ContentType, &item.Size, &item.Width, &item.Height,
+			&item.UploaderID, &item.CreatedAt, &item.UsageCount, &total,
+		); err != nil {
+			return nil, 0, err
+		}
+		media = append(media, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// A page past the end has no rows to carry the total
+	if len(media) == 0 && page > 1 {
+		if err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM media`).Scan(&total); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return media, total, nil
+}
+
+// Delete removes media and its file. Unless force is set it returns
+// ErrMediaInUse while any post, including trashed ones, embeds it; it
+// returns sql.ErrNoRows when no such media exists.
+func (s *MediaService) Delete(ctx context.Context, id string, force bool) error {
+	ctx, span := tracer.Start(ctx, "MediaService.Delete")
+	defer span.End()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var key string
+	var usage int
+	err = tx.QueryRowContext(ctx, `
+		SELECT m.storage_key, (SELECT COUNT(*) FROM posts p WHERE strpos(p.content, m.url) > 0)
+		FROM media m
+		WHERE m.id = $1
+		FOR UPDATE
+	`, id).Scan(&key, &usage)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if usage > 0 && !force {
+		tx.Rollback()
+		return ErrMediaInUse
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM media WHERE id = $1`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// The record is gone either way, so a file left behind is only logged
+	if err := s.storage.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		s.log.WarnContext(ctx, "failed to remove media file", "media_id", id, "key", key, "error", err)
+	}
+
+	s.log.InfoContext(ctx, "media deleted", "media_id", id, "usage", usage)
+	return nil
+}
+
+// imageSize reads the pixel dimensions of an image of the given type
+func imageSize(contentType string, data []byte) (int, int, error) {
+	if contentType == "image/webp" {
+		return webpSize(data)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// webpSize reads the dimensions from the first chunk of a WebP file, which
+// the standard library cannot decode
+func webpSize(data []byte) (int, int, error) {
+	if len(data) < 30 {
+		return 0, 0, ErrUnsupportedMedia
+	}
+
+	switch string(data[12:16]) {
+	case "VP8 ":
+		// Lossy: a frame tag and start code precede 14-bit dimensions
+		if data[23] != 0x9d || data[24] != 0x01 || data[25] != 0x2a {
+			return 0, 0, ErrUnsupportedMedia
+		}
+		width := binary.LittleEndian.Uint16(data[26:28]) & 0x3fff
+		height := binary.LittleEndian.Uint16(data[28:30]) & 0x3fff
+		return int(width), int(height), nil
+	case "VP8L":
+		// Lossless: a signature byte precedes 14-bit dimensions minus one
+		if data[20] != 0x2f {
+			return 0, 0, ErrUnsupportedMedia
+		}
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, nil
+	case "VP8X":
+		// Extended: 24-bit canvas dimensions minus one
+		width := uint32(data[24]) | uint32(data[25])<<8 | uint32(data[26])<<16
+		height := uint32(data[27]) | uint32(data[28])<<8 | uint32(data[29])<<16
+		return int(width) + 1, int(height) + 1, nil
+	}
+	return 0, 0, ErrUnsupportedMedia
+}
@@ -1,26 +1,40 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
+	"log/slog"
 	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/metrics"
 )
 
 // Post represents a blog post
 type Post struct {
-	ID        string    `json:"id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	Excerpt   string    `json:"excerpt"`
-	Slug      string    `json:"slug"`
-	Published bool      `json:"published"`
-	ReadTime  int       `json:"readTime"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-	Author    Author    `json:"author"`
-	Tags      []Tag     `json:"tags"`
-	Comments  []Comment `json:"comments,omitempty"`
+	ID        string         `json:"id"`
+	Title     string         `json:"title"`
+	Content   string         `json:"content"`
+	Excerpt   string         `json:"excerpt"`
+	Slug      string         `json:"slug"`
+	Published bool           `json:"published"`
+	ReadTime  int            `json:"readTime"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	Version   int            `json:"version"`
+	DeletedAt *time.Time     `json:"deletedAt,omitempty"`
+	Category  *CategoryRef   `json:"category"`
+	Series    *PostSeries    `json:"series,omitempty"`
+	Adjacent  *AdjacentPosts `json:"adjacent,omitempty"`
+	Author    Author         `json:"author"`
+	Authors   []PostAuthor   `json:"authors"`
+	Tags      []Tag          `json:"tags"`
+	Comments  []Comment      `json:"comments,omitempty"`
 }
 
 // PostFormData represents the form data for creating/updating a post
@@ -32,6 +46,10 @@ type PostFormData struct {
 	Slug      string   `json:"slug"`
 	Published bool     `json:"published"`
 	Tags      []string `json:"tags"`
+	// CategoryID is the post's primary category; empty means none
+	CategoryID string `json:"categoryId"`
+	// CoAuthors lists who wrote the post with its author, in order
+	CoAuthors []CoAuthor `json:"coAuthors"`
 }
 
 // Author represents a user who wrote a post or comment
@@ -43,26 +61,69 @@ type Author struct {
 	IsAdmin bool   `json:"isAdmin"`
 }
 
+// ErrPostSlugTaken is returned when another post outside the trash
+// already uses a slug
+var ErrPostSlugTaken = errors.New("slug is already used by another post")
+
+// postSlugConflict maps unique violations on live post slugs to
+// ErrPostSlugTaken and returns other errors unchanged
+func postSlugConflict(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "posts_slug_live_key" {
+		return ErrPostSlugTaken
+	}
+	return err
+}
+
+// VersionConflictError reports that a post was modified after the client
+// read the version it tried to update
+type VersionConflictError struct {
+	CurrentVersion int
+}
+
+// Error implements the error interface
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("post has been modified; current version is %d", e.CurrentVersion)
+}
+
 // PostService provides methods to interact with posts in the database
 type PostService struct {
-	DB *sql.DB
+	DB      *sql.DB
+	log     *slog.Logger
+	metrics *metrics.Metrics
+	cache   *cache.Loader
+	ttl     config.CacheConfig
 }
 
 // NewPostService creates a new post service
-func NewPostService(db *sql.DB) *PostService {
-	return &PostService{DB: db}
+func NewPostService(db *sql.DB, logger *slog.Logger, m *metrics.Metrics, loader *cache.Loader, ttl config.CacheConfig) *PostService {
+	return &PostService{DB: db, log: logger, metrics: m, cache: loader, ttl: ttl}
 }
 
 // GetAll retrieves all posts with pagination
-func (s *PostService) GetAll(page, limit int) ([]Post, error) {
+func (s *PostService) GetAll(ctx context.Context, page, limit int) ([]Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetAll")
+	defer span.End()
+
+	return cache.Load(ctx, s.cache, postPageKey(page, limit), s.ttl.ListTTL, func(ctx context.Context) ([]Post, error) {
+		return s.loadAll(ctx, page, limit)
+	})
+}
+
+// loadAll reads a page of posts from the database
+func (s *PostService) loadAll(ctx context.Context, page, limit int) ([]Post, error) {
 	offset := (page - 1) * limit
 
-	rows, err := s.DB.Query(`
+	rows, err := s.DB.QueryContext(ctx, `
 		SELECT
 			p.id, p.title, p.excerpt, p.slug, p.published, p.read_time,
-			p.created_at, p.updated_at,
-			p.author_id, p.author_email, p.author_name, p.author_picture, p.author_is_admin
+			p.created_at, p.updated_at, p.version,
+			u.id, u.email, u.name, u.picture, u.is_admin,
+			c.id, c.name, c.slug
 		FROM posts p
+		JOIN users u ON u.id = p.author_id
+		LEFT JOIN categories c ON c.id = p.category_id
+		WHERE p.deleted_at IS NULL
 		ORDER BY p.created_at DESC
 		LIMIT $1 OFFSET $2
 	`, limit, offset)
@@ -74,21 +135,30 @@ func (s *PostService) GetAll(page, limit int) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
+		var categoryID, categoryName, categorySlug sql.NullString
 		if err := rows.Scan(
 			&post.ID, &post.Title, &post.Excerpt, &post.Slug, &post.Published, &post.ReadTime,
-			&post.CreatedAt, &post.UpdatedAt,
+			&post.CreatedAt, &post.UpdatedAt, &post.Version,
 			&post.Author.ID, &post.Author.Email, &post.Author.Name, &post.Author.Picture, &post.Author.IsAdmin,
+			&categoryID, &categoryName, &categorySlug,
 		); err != nil {
 			return nil, err
 		}
+		post.Category = categoryRefFrom(categoryID, categoryName, categorySlug)
 
-		tags, err := s.getTagsForPost(post.ID)
+		tags, err := s.getTagsForPost(ctx, post.ID)
 		if err != nil {
 			return nil, err
 		}
 		post.Tags = tags
 
-		comments, err := s.getCommentsForPost(post.ID)
+		authors, err := s.getAuthorsForPost(ctx, post.ID, post.Author)
+		if err != nil {
+			return nil, err
+		}
+		post.Authors = authors
+
+		comments, err := s.getCommentsForPost(ctx, post.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -100,33 +170,147 @@ func (s *PostService) GetAll(page, limit int) ([]Post, error) {
 	return posts, rows.Err()
 }
 
+// GetPublishedByTag retrieves a page of published posts carrying a tag,
+// newest first, along with how many such posts there are in total
+func (s *PostService) GetPublishedByTag(ctx context.Context, tagID string, page, limit int) ([]Post, int, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetPublishedByTag")
+	defer span.End()
+
+	return s.listPublished(ctx, `p.id IN (SELECT post_id FROM post_tags WHERE tag_id = $1)`, tagID, page, limit)
+}
+
+// GetPublishedInCategory retrieves a page of published posts whose primary
+// category is the given one or any of its descendants, newest first, along
+// with how many such posts there are in total
+func (s *PostService) GetPublishedInCategory(ctx context.Context, categoryID string, page, limit int) ([]Post, int, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetPublishedInCategory")
+	defer span.End()
+
+	return s.listPublished(ctx, `p.category_id IN (
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id FROM categories c JOIN subtree t ON c.parent_id = t.id
+		)
+		SELECT id FROM subtree
+	)`, categoryID, page, limit)
+}
+
+// listPublished reads a page of published posts matching filter, a
+// condition on posts p whose only parameter $1 is arg, and counts them all
+func (s *PostService) listPublished(ctx context.Context, filter string, arg any, page, limit int) ([]Post, int, error) {
+	offset := (page - 1) * limit
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT
+			p.id, p.title, p.excerpt, p.slug, p.published, p.read_time,
+			p.created_at, p.updated_at, p.version,
+			u.id, u.email, u.name, u.picture, u.is_admin,
+			c.id, c.name, c.slug,
+			COUNT(*) OVER ()
+		FROM posts p
+		JOIN users u ON u.id = p.author_id
+		LEFT JOIN categories c ON c.id = p.category_id
+		WHERE `+filter+` AND p.published AND p.deleted_at IS NULL
+		ORDER BY p.created_at DESC
+		LIMIT $2 OFFSET $3
+	`, arg, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	total := 0
+	for rows.Next() {
+		var post Post
+		var categoryID, categoryName, categorySlug sql.NullString
+		if err := rows.Scan(
+			&post.ID, &post.Title, &post.Excerpt, &post.Slug, &post.Published, &post.ReadTime,
+			&post.CreatedAt, &post.UpdatedAt, &post.Version,
+			&post.Author.ID, &post.Author.Email, &post.Author.Name, &post.Author.Picture, &post.Author.IsAdmin,
+			&categoryID, &categoryName, &categorySlug,
+			&total,
+		); err != nil {
+			return nil, 0, err
+		}
+		post.Category = categoryRefFrom(categoryID, categoryName, categorySlug)
+
+		tags, err := s.getTagsForPost(ctx, post.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		post.Tags = tags
+
+		authors, err := s.getAuthorsForPost(ctx, post.ID, post.Author)
+		if err != nil {
+			return nil, 0, err
+		}
+		post.Authors = authors
+
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// A page past the end has no rows to carry the total
+	if len(posts) == 0 && page > 1 {
+		err := s.DB.QueryRowContext(ctx, `
+			SELECT COUNT(*)
+			FROM posts p
+			WHERE `+filter+` AND p.published AND p.deleted_at IS NULL
+		`, arg).Scan(&total)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return posts, total, nil
+}
+
 // GetByID retrieves a post by its ID
-func (s *PostService) GetByID(id string) (Post, error) {
+func (s *PostService) GetByID(ctx context.Context, id string) (Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetByID")
+	defer span.End()
+
 	var post Post
-	err := s.DB.QueryRow(`
+	var categoryID, categoryName, categorySlug sql.NullString
+	err := s.DB.QueryRowContext(ctx, `
 		SELECT
 			p.id, p.title, p.content, p.excerpt, p.slug, p.published, p.read_time,
-			p.created_at, p.updated_at,
-			p.author_id, p.author_email, p.author_name, p.author_picture, p.author_is_admin
+			p.created_at, p.updated_at, p.version,
+			u.id, u.email, u.name, u.picture, u.is_admin,
+			c.id, c.name, c.slug
 		FROM posts p
-		WHERE p.id = $1
+		JOIN users u ON u.id = p.author_id
+		LEFT JOIN categories c ON c.id = p.category_id
+		WHERE p.id = $1 AND p.deleted_at IS NULL
 	`, id).Scan(
 		&post.ID, &post.Title, &post.Content, &post.Excerpt, &post.Slug, &post.Published, &post.ReadTime,
-		&post.CreatedAt, &post.UpdatedAt,
+		&post.CreatedAt, &post.UpdatedAt, &post.Version,
 		&post.Author.ID, &post.Author.Email, &post.Author.Name, &post.Author.Picture, &post.Author.IsAdmin,
+		&categoryID, &categoryName, &categorySlug,
 	)
 
 	if err != nil {
 		return post, err
 	}
+	post.Category = categoryRefFrom(categoryID, categoryName, categorySlug)
 
-	tags, err := s.getTagsForPost(post.ID)
+	tags, err := s.getTagsForPost(ctx, post.ID)
 	if err != nil {
 		return post, err
 	}
 	post.Tags = tags
 
-	comments, err := s.getCommentsForPost(post.ID)
+	authors, err := s.getAuthorsForPost(ctx, post.ID, post.Author)
+	if err != nil {
+		return post, err
+	}
+	post.Authors = authors
+
+	comments, err := s.getCommentsForPost(ctx, post.ID)
 	if err != nil {
 		return post, err
 	}
@@ -136,43 +320,74 @@ func (s *PostService) GetByID(id string) (Post, error) {
 }
 
 // GetBySlug retrieves a post by its slug
-func (s *PostService) GetBySlug(slug string) (Post, error) {
+func (s *PostService) GetBySlug(ctx context.Context, slug string) (Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetBySlug")
+	defer span.End()
+
+	return cache.Load(ctx, s.cache, postSlugKey(slug), s.ttl.PostTTL, func(ctx context.Context) (Post, error) {
+		return s.loadBySlug(ctx, slug)
+	})
+}
+
+// loadBySlug reads a post by its slug from the database
+func (s *PostService) loadBySlug(ctx context.Context, slug string) (Post, error) {
 	var post Post
-	err := s.DB.QueryRow(`
+	var categoryID, categoryName, categorySlug sql.NullString
+	err := s.DB.QueryRowContext(ctx, `
 		SELECT
 			p.id, p.title, p.content, p.excerpt, p.slug, p.published, p.read_time,
-			p.created_at, p.updated_at,
-			p.author_id, p.author_email, p.author_name, p.author_picture, p.author_is_admin
+			p.created_at, p.updated_at, p.version,
+			u.id, u.email, u.name, u.picture, u.is_admin,
+			c.id, c.name, c.slug
 		FROM posts p
-		WHERE p.slug = $1
+		JOIN users u ON u.id = p.author_id
+		LEFT JOIN categories c ON c.id = p.category_id
+		WHERE p.slug = $1 AND p.deleted_at IS NULL
 	`, slug).Scan(
 		&post.ID, &post.Title, &post.Content, &post.Excerpt, &post.Slug, &post.Published, &post.ReadTime,
-		&post.CreatedAt, &post.UpdatedAt,
+		&post.CreatedAt, &post.UpdatedAt, &post.Version,
 		&post.Author.ID, &post.Author.Email, &post.Author.Name, &post.Author.Picture, &post.Author.IsAdmin,
+		&categoryID, &categoryName, &categorySlug,
 	)
 
 	if err != nil {
 		return post, err
 	}
+	post.Category = categoryRefFrom(categoryID, categoryName, categorySlug)
 
-	tags, err := s.getTagsForPost(post.ID)
+	tags, err := s.getTagsForPost(ctx, post.ID)
 	if err != nil {
 		return post, err
 	}
 	post.Tags = tags
 
-	comments, err := s.getCommentsForPost(post.ID)
+	authors, err := s.getAuthorsForPost(ctx, post.ID, post.Author)
+	if err != nil {
+		return post, err
+	}
+	post.Authors = authors
+
+	comments, err := s.getCommentsForPost(ctx, post.ID)
 	if err != nil {
 		return post, err
 	}
 	post.Comments = comments
 
+	series, err := s.getSeriesForPost(ctx, post.ID)
+	if err != nil {
+		return post, err
+	}
+	post.Series = series
+
 	return post, nil
 }
 
 // Create adds a new post
-func (s *PostService) Create(postData PostFormData, author Author) (Post, error) {
-	tx, err := s.DB.Begin()
+func (s *PostService) Create(ctx context.Context, postData PostFormData, author Author) (Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.Create")
+	defer span.End()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return Post{}, err
 	}
@@ -182,170 +397,226 @@ func (s *PostService) Create(postData PostFormData, author Author) (Post, error)
 		postID = generateID()
 	}
 
-	words := strings.Fields(postData.Content)
-	readTime := len(words) / 200
-	if readTime == 0 {
-		readTime = 1
+	readTime := readTimeFor(postData.Content)
+
+	category, err := categoryRef(ctx, tx, postData.CategoryID)
+	if err != nil {
+		tx.Rollback()
+		return Post{}, err
+	}
+
+	author, profileChanged, err := upsertUser(ctx, tx, author)
+	if err != nil {
+		tx.Rollback()
+		return Post{}, err
 	}
 
 	var post Post
-	err = tx.QueryRow(`
+	err = tx.QueryRowContext(ctx, `
 		INSERT INTO posts (
 			id, title, content, excerpt, slug, published, read_time,
-			created_at, updated_at,
-			author_id, author_email, author_name, author_picture, author_is_admin
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
-		RETURNING id, title, content, excerpt, slug, published, read_time, created_at, updated_at
+			created_at, updated_at, author_id, category_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''))
+		RETURNING id, title, content, excerpt, slug, published, read_time, created_at, updated_at, version
 	`,
 		postID, postData.Title, postData.Content, postData.Excerpt, postData.Slug, postData.Published, readTime,
-		time.Now(), time.Now(),
-		author.ID, author.Email, author.Name, author.Picture, author.IsAdmin,
+		time.Now(), time.Now(), author.ID,
+		postData.CategoryID,
 	).Scan(
 		&post.ID, &post.Title, &post.Content, &post.Excerpt, &post.Slug, &post.Published, &post.ReadTime,
-		&post.CreatedAt, &post.UpdatedAt,
+		&post.CreatedAt, &post.UpdatedAt, &post.Version,
 	)
 
 	if err != nil {
 		tx.Rollback()
-		return Post{}, err
+		return Post{}, postSlugConflict(err)
 	}
 
 	post.Author = author
+	post.Category = category
 
-	for _, tagName := range postData.Tags {
-		var tagID string
-		err := tx.QueryRow(`
-			SELECT id FROM tags WHERE name = $1
-		`, tagName).Scan(&tagID)
-
-		if err == sql.ErrNoRows {
-			err = tx.QueryRow(`
-				INSERT INTO tags (id, name) VALUES ($1, $2)
-				RETURNING id
-			`, generateID(), tagName).Scan(&tagID)
-
-			if err != nil {
-				tx.Rollback()
-				return Post{}, err
-			}
-		} else if err != nil {
-			tx.Rollback()
-			return Post{}, err
-		}
-
-		_, err = tx.Exec(`
-			INSERT INTO post_tags (post_id, tag_id) VALUES ($1, $2)
-		`, post.ID, tagID)
-
-		if err != nil {
-			tx.Rollback()
-			return Post{}, err
-		}
+	tags, err := linkTags(ctx, tx, post.ID, postData.Tags)
+	if err != nil {
+		tx.Rollback()
+		return Post{}, err
+	}
+	post.Tags = tags
 
-		post.Tags = append(post.Tags, Tag{ID: tagID, Name: tagName})
+	if err := setCoAuthors(ctx, tx, post.ID, author.ID, postData.CoAuthors); err != nil {
+		tx.Rollback()
+		return Post{}, err
 	}
 
 	if err := tx.Commit(); err != nil {
 		return Post{}, err
 	}
 
+	post.Authors, err = s.getAuthorsForPost(ctx, post.ID, post.Author)
+	if err != nil {
+		return Post{}, err
+	}
+
+	s.cache.InvalidatePrefix(ctx, postPagePrefix)
+	s.cache.InvalidatePrefix(ctx, postRelatedPrefix)
+	s.cache.Invalidate(ctx, postSlugKey(post.Slug), archiveKey)
+	if len(post.Tags) > 0 {
+		s.cache.Invalidate(ctx, tagsKey, tagCountsKey)
+	}
+	if profileChanged {
+		invalidateProfiles(ctx, s.cache)
+	}
+
+	if post.Published {
+		s.metrics.PostPublished()
+	}
+
+	s.log.InfoContext(ctx, "post created", "post_id", post.ID, "published", post.Published, "tags", len(post.Tags))
 	return post, nil
 }
 
-// Update modifies an existing post
-func (s *PostService) Update(id string, postData PostFormData) (Post, error) {
-	tx, err := s.DB.Begin()
+// Update modifies an existing post if its version still equals version;
+// a version of 0 skips the check. It returns a *VersionConflictError when
+// the post was changed by someone else in the meantime.
+func (s *PostService) Update(ctx context.Context, id string, version int, postData PostFormData) (Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.Update")
+	defer span.End()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Post{}, err
+	}
+
+	readTime := readTimeFor(postData.Content)
+
+	// Lock the row and remember its slug and whether this update publishes it
+	var oldSlug string
+	var wasPublished bool
+	var currentVersion int
+	err = tx.QueryRowContext(ctx, `
+		SELECT slug, published, version FROM posts WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	`, id).Scan(&oldSlug, &wasPublished, &currentVersion)
 	if err != nil {
+		tx.Rollback()
 		return Post{}, err
 	}
 
-	words := strings.Fields(postData.Content)
-	readTime := len(words) / 200
-	if readTime == 0 {
-		readTime = 1
+	if version != 0 && version != currentVersion {
+		tx.Rollback()
+		return Post{}, &VersionConflictError{CurrentVersion: currentVersion}
+	}
+
+	category, err := categoryRef(ctx, tx, postData.CategoryID)
+	if err != nil {
+		tx.Rollback()
+		return Post{}, err
 	}
 
 	var post Post
-	err = tx.QueryRow(`
+	err = tx.QueryRowContext(ctx, `
 		UPDATE posts
-		SET title = $1, content = $2, excerpt = $3, slug = $4, published = $5, read_time = $6, updated_at = $7
+		SET title = $1, content = $2, excerpt = $3, slug = $4, published = $5, read_time = $6, updated_at = $7,
+			category_id = NULLIF($9, ''), version = version + 1
 		WHERE id = $8
-		RETURNING id, title, content, excerpt, slug, published, read_time, created_at, updated_at, author_id, author_email, author_name, author_picture, author_is_admin
+		RETURNING id, title, content, excerpt, slug, published, read_time, created_at, updated_at, version, author_id
 	`,
 		postData.Title, postData.Content, postData.Excerpt, postData.Slug, postData.Published, readTime, time.Now(), id,
+		postData.CategoryID,
 	).Scan(
 		&post.ID, &post.Title, &post.Content, &post.Excerpt, &post.Slug, &post.Published, &post.ReadTime,
-		&post.CreatedAt, &post.UpdatedAt, &post.Author.ID, &post.Author.Email, &post.Author.Name, &post.Author.Picture, &post.Author.IsAdmin,
+		&post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Author.ID,
 	)
 
+	if err != nil {
+		tx.Rollback()
+		return Post{}, postSlugConflict(err)
+	}
+	post.Category = category
+
+	post.Author, err = getUser(ctx, tx, post.Author.ID)
 	if err != nil {
 		tx.Rollback()
 		return Post{}, err
 	}
 
 	// Remove existing tags for the post
-	_, err = tx.Exec(`DELETE FROM post_tags WHERE post_id = $1`, id)
+	_, err = tx.ExecContext(ctx, `DELETE FROM post_tags WHERE post_id = $1`, id)
 	if err != nil {
 		tx.Rollback()
 		return Post{}, err
 	}
 
 	// Add new tags
-	var tags []Tag
-	for _, tagName := range postData.Tags {
-		var tagID string
-		err := tx.QueryRow(`
-			SELECT id FROM tags WHERE name = $1
-		`, tagName).Scan(&tagID)
-
-		if err == sql.ErrNoRows {
-			// Create new tag
-			err = tx.QueryRow(`
-				INSERT INTO tags (id, name) VALUES ($1, $2)
-				RETURNING id
-			`, generateID(), tagName).Scan(&tagID)
-
-			if err != nil {
-				tx.Rollback()
-				return Post{}, err
-			}
-		} else if err != nil {
-			tx.Rollback()
-			return Post{}, err
-		}
-
-		// Link tag to post
-		_, err = tx.Exec(`
-			INSERT INTO post_tags (post_id, tag_id) VALUES ($1, $2)
-		`, id, tagID)
+	tags, err := linkTags(ctx, tx, id, postData.Tags)
+	if err != nil {
+		tx.Rollback()
+		return Post{}, err
+	}
+	post.Tags = tags
 
-		if err != nil {
+	// Leaving out coAuthors keeps them, so editors unaware of them do not
+	// drop them; an empty list removes them all
+	if postData.CoAuthors != nil {
+		if err := setCoAuthors(ctx, tx, id, post.Author.ID, postData.CoAuthors); err != nil {
 			tx.Rollback()
 			return Post{}, err
 		}
-		tags = append(tags, Tag{ID: tagID, Name: tagName})
 	}
-	post.Tags = tags
 
 	if err := tx.Commit(); err != nil {
 		return Post{}, err
 	}
 
+	post.Authors, err = s.getAuthorsForPost(ctx, post.ID, post.Author)
+	if err != nil {
+		return Post{}, err
+	}
+
+	s.cache.InvalidatePrefix(ctx, postPagePrefix)
+	s.cache.InvalidatePrefix(ctx, postRelatedPrefix)
+	s.cache.Invalidate(ctx, postSlugKey(oldSlug), postSlugKey(post.Slug), tagsKey, tagCountsKey, archiveKey)
+	s.invalidateSeriesOf(ctx, post.ID)
+
+	if post.Published && !wasPublished {
+		s.metrics.PostPublished()
+	}
+
+	s.log.InfoContext(ctx, "post updated", "post_id", post.ID, "version", post.Version, "published", post.Published, "tags", len(post.Tags))
 	return post, nil
 }
 
-// Delete removes a post
-func (s *PostService) Delete(id string) error {
-	_, err := s.DB.Exec(`
-		DELETE FROM posts WHERE id = $1
-	`, id)
-	return err
+// Delete moves a post to the trash. Its comments and tag links are kept
+// so that Restore can bring it back; it returns sql.ErrNoRows when no
+// live post has the given ID.
+func (s *PostService) Delete(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "PostService.Delete")
+	defer span.End()
+
+	var slug string
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE posts SET deleted_at = $2
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING slug
+	`, id, time.Now()).Scan(&slug)
+	if err != nil {
+		return err
+	}
+
+	s.cache.InvalidatePrefix(ctx, postPagePrefix)
+	s.cache.InvalidatePrefix(ctx, postRelatedPrefix)
+	s.cache.Invalidate(ctx, postSlugKey(slug), tagCountsKey, archiveKey)
+	s.invalidateSeriesOf(ctx, id)
+
+	s.log.InfoContext(ctx, "post moved to trash", "post_id", id)
+	return nil
 }
 
 // Helper function to get tags for a post
-func (s *PostService) getTagsForPost(postID string) ([]Tag, error) {
-	rows, err := s.DB.Query(`
-		SELECT t.id, t.name
+func (s *PostService) getTagsForPost(ctx context.Context, postID string) ([]Tag, error) {
+	ctx, span := tracer.Start(ctx, "PostService.getTagsForPost")
+	defer span.End()
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT t.id, t.name, t.slug, t.description, t.color
 		FROM tags t
 		JOIN post_tags pt ON t.id = pt.tag_id
 		WHERE pt.post_id = $1
@@ -359,7 +630,7 @@ func (s *PostService) getTagsForPost(postID string) ([]Tag, error) {
 	var tags []Tag
 	for rows.Next() {
 		var tag Tag
-		if err := rows.Scan(&tag.ID, &tag.Name); err != nil {
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Description, &tag.Color); err != nil {
 			return nil, err
 		}
 		tags = append(tags, tag)
@@ -369,12 +640,16 @@ func (s *PostService) getTagsForPost(postID string) ([]Tag, error) {
 }
 
 // Helper function to get comments for a post
-func (s *PostService) getCommentsForPost(postID string) ([]Comment, error) {
-	rows, err := s.DB.Query(`
+func (s *PostService) getCommentsForPost(ctx context.Context, postID string) ([]Comment, error) {
+	ctx, span := tracer.Start(ctx, "PostService.getCommentsForPost")
+	defer span.End()
+
+	rows, err := s.DB.QueryContext(ctx, `
 		SELECT
 			c.id, c.content, c.created_at, c.post_id,
-			c.author_id, c.author_email, c.author_name, c.author_picture, c.author_is_admin
+			u.id, u.email, u.name, u.picture, u.is_admin
 		FROM comments c
+		JOIN users u ON u.id = c.author_id
 		WHERE c.post_id = $1
 		ORDER BY c.created_at DESC
 	`, postID)
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+// AdjacentScope limits previous/next navigation to posts sharing a tag or
+// falling in a category, each given by slug; the zero value spans every
+// published post
+type AdjacentScope struct {
+	Tag      string
+	Category string
+}
+
+// AdjacentPosts links a post to the published posts written just before
+// and just after it
+type AdjacentPosts struct {
+	Older *PostLink `json:"older"`
+	Newer *PostLink `json:"newer"`
+}
+
+// GetAdjacent finds the published posts immediately older and newer than
+// the given one within scope. A category scope includes its descendants.
+// The post itself need not be published or in scope.
+func (s *PostService) GetAdjacent(ctx context.Context, postID string, scope AdjacentScope) (AdjacentPosts, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetAdjacent")
+	defer span.End()
+
+	filter, arg := `$2 = ''`, ""
+	switch {
+	case scope.Tag != "":
+		filter, arg = `p.id IN (
+			SELECT pt.post_id FROM post_tags pt JOIN tags t ON t.id = pt.tag_id WHERE t.slug = $2
+		)`, scope.Tag
+	case scope.Category != "":
+		filter, arg = `p.category_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE slug = $2
+				UNION ALL
+				SELECT c.id FROM categories c JOIN subtree t ON c.parent_id = t.id
+			)
+			SELECT id FROM subtree
+		)`, scope.Category
+	}
+
+	var adjacent AdjacentPosts
+	var olderID, olderTitle, olderSlug, newerID, newerTitle, newerSlug sql.NullString
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT m.older_id, m.older_title, m.older_slug, m.newer_id, m.newer_title, m.newer_slug
+		FROM (
+			SELECT p.id,
+				lag(p.id) OVER w AS older_id, lag(p.title) OVER w AS older_title, lag(p.slug) OVER w AS older_slug,
+				lead(p.id) OVER w AS newer_id, lead(p.title) OVER w AS newer_title, lead(p.slug) OVER w AS newer_slug
+			FROM posts p
+			WHERE p.id = $1 OR (p.published AND p.deleted_at IS NULL AND `+filter+`)
+			WINDOW w AS (ORDER BY p.created_at, p.id)
+		) m
+		WHERE m.id = $1
+	`, postID, arg).Scan(&olderID, &olderTitle, &olderSlug, &newerID, &newerTitle, &newerSlug)
+	if err != nil {
+		return adjacent, err
+	}
+
+	if olderID.Valid {
+		adjacent.Older = &PostLink{ID: olderID.String, Title: olderTitle.String, Slug: olderSlug.String}
+	}
+	if newerID.Valid {
+		adjacent.Newer = &PostLink{ID: newerID.String, Title: newerTitle.String, Slug: newerSlug.String}
+	}
+	return adjacent, nil
+}
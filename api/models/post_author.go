@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// Roles shown in a post's author list
+const (
+	PrimaryAuthorRole   = "author"
+	DefaultCoAuthorRole = "co-author"
+)
+
+// Limits on a post's co-authors
+const (
+	maxCoAuthors    = 10
+	maxCoAuthorRole = 50
+)
+
+var (
+	// ErrCoAuthorNotFound is returned when a co-author has never signed in
+	ErrCoAuthorNotFound = errors.New("co-author not found")
+	// ErrInvalidCoAuthors is returned when co-authors repeat, include the
+	// post's author or exceed the limits
+	ErrInvalidCoAuthors = errors.New("co-authors must be at most 10 distinct users other than the author, with roles of at most 50 characters")
+)
+
+// PostAuthor is one entry of a post's author list
+type PostAuthor struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+	Role    string `json:"role"`
+}
+
+// CoAuthor names a user who wrote a post jointly with its author; an empty
+// role means DefaultCoAuthorRole
+type CoAuthor struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+// getAuthorsForPost lists a post's author followed by its co-authors in order
+func (s *PostService) getAuthorsForPost(ctx context.Context, postID string, author Author) ([]PostAuthor, error) {
+	ctx, span := tracer.Start(ctx, "PostService.getAuthorsForPost")
+	defer span.End()
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT u.id, u.name, u.picture, pc.role
+		FROM post_coauthors pc
+		JOIN users u ON u.id = pc.user_id
+		WHERE pc.post_id = $1
+		ORDER BY pc.position ASC
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []PostAuthor{{ID: author.ID, Name: author.Name, Picture: author.Picture, Role: PrimaryAuthorRole}}
+	for rows.Next() {
+		var coAuthor PostAuthor
+		if err := rows.Scan(&coAuthor.ID, &coAuthor.Name, &coAuthor.Picture, &coAuthor.Role); err != nil {
+			return nil, err
+		}
+		authors = append(authors, coAuthor)
+	}
+
+	return authors, rows.Err()
+}
+
+// setCoAuthors replaces a post's co-authors inside tx. It returns
+// ErrInvalidCoAuthors for repeated users, the author themself or lists
+// over the limits, and ErrCoAuthorNotFound for unknown users.
+func setCoAuthors(ctx context.Context, tx *sql.Tx, postID, authorID string, coAuthors []CoAuthor) error {
+	if len(coAuthors) > maxCoAuthors {
+		return ErrInvalidCoAuthors
+	}
+
+	ids := make([]string, len(coAuthors))
+	roles := make([]string, len(coAuthors))
+	seen := map[string]bool{authorID: true}
+	for i, coAuthor := range coAuthors {
+		if coAuthor.ID == "" || seen[coAuthor.ID] || utf8.RuneCountInString(coAuthor.Role) > maxCoAuthorRole {
+			return ErrInvalidCoAuthors
+		}
+		seen[coAuthor.ID] = true
+
+		ids[i] = coAuthor.ID
+		roles[i] = coAuthor.Role
+		if roles[i] == "" {
+			roles[i] = DefaultCoAuthorRole
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_coauthors WHERE post_id = $1`, postID); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO post_coauthors (post_id, user_id, role, position)
+		SELECT $1, c.user_id, c.role, c.position
+		FROM unnest($2::text[], $3::text[]) WITH ORDINALITY AS c(user_id, role, position)
+	`, postID, pq.Array(ids), pq.Array(roles))
+	if isForeignKeyViolation(err) {
+		return ErrCoAuthorNotFound
+	}
+	return err
+}
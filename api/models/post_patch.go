@@ -0,0 +1,219 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostPatch describes a partial update of a post; nil fields are left
+// unchanged
+type PostPatch struct {
+	Title     *string   `json:"title"`
+	Content   *string   `json:"content"`
+	Excerpt   *string   `json:"excerpt"`
+	Slug      *string   `json:"slug"`
+	Published *bool     `json:"published"`
+	Tags      *TagPatch `json:"tags"`
+	// CategoryID replaces the primary category; an empty ID clears it
+	CategoryID *string `json:"categoryId"`
+	// CoAuthors replaces the co-authors; an empty list removes them all
+	CoAuthors *[]CoAuthor `json:"coAuthors"`
+}
+
+// TagPatch changes a post's tags; Set replaces them all, otherwise Remove
+// is applied before Add
+type TagPatch struct {
+	Set    []string `json:"-"`
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// Patch applies patch to a post if its version still equals version; a
+// version of 0 skips the check. Tags not named in the patch are kept.
+func (s *PostService) Patch(ctx context.Context, id string, version int, patch PostPatch) (Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.Patch")
+	defer span.End()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Post{}, err
+	}
+
+	var current PostFormData
+	var currentVersion int
+	var authorID string
+	err = tx.QueryRowContext(ctx, `
+		SELECT title, content, excerpt, slug, published, COALESCE(category_id, ''), version, author_id
+		FROM posts
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, id).Scan(
+		&current.Title, &current.Content, &current.Excerpt, &current.Slug, &current.Published, &current.CategoryID, &currentVersion,
+		&authorID,
+	)
+	if err != nil {
+		tx.Rollback()
+		return Post{}, err
+	}
+
+	if version != 0 && version != currentVersion {
+		tx.Rollback()
+		return Post{}, &VersionConflictError{CurrentVersion: currentVersion}
+	}
+
+	oldSlug, wasPublished := current.Slug, current.Published
+	next := current
+	if patch.Title != nil {
+		next.Title = *patch.Title
+	}
+	if patch.Content != nil {
+		next.Content = *patch.Content
+	}
+	if patch.Excerpt != nil {
+		next.Excerpt = *patch.Excerpt
+	}
+	if patch.Slug != nil {
+		next.Slug = *patch.Slug
+	}
+	if patch.Published != nil {
+		next.Published = *patch.Published
+	}
+	if patch.CategoryID != nil {
+		if _, err := categoryRef(ctx, tx, *patch.CategoryID); err != nil {
+			tx.Rollback()
+			return Post{}, err
+		}
+		next.CategoryID = *patch.CategoryID
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE posts
+		SET title = $1, content = $2, excerpt = $3, slug = $4, published = $5, read_time = $6, updated_at = $7,
+			category_id = NULLIF($9, ''), version = version + 1
+		WHERE id = $8
+	`,
+		next.Title, next.Content, next.Excerpt, next.Slug, next.Published, readTimeFor(next.Content), time.Now(), id,
+		next.CategoryID,
+	)
+	if err != nil {
+		tx.Rollback()
+		return Post{}, postSlugConflict(err)
+	}
+
+	if patch.Tags != nil {
+		if err := s.patchTags(ctx, tx, id, *patch.Tags); err != nil {
+			tx.Rollback()
+			return Post{}, err
+		}
+	}
+
+	if patch.CoAuthors != nil {
+		if err := setCoAuthors(ctx, tx, id, authorID, *patch.CoAuthors); err != nil {
+			tx.Rollback()
+			return Post{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Post{}, err
+	}
+
+	s.cache.InvalidatePrefix(ctx, postPagePrefix)
+	s.cache.InvalidatePrefix(ctx, postRelatedPrefix)
+	s.cache.Invalidate(ctx, postSlugKey(oldSlug), postSlugKey(next.Slug), tagsKey, tagCountsKey, archiveKey)
+	s.invalidateSeriesOf(ctx, id)
+
+	if next.Published && !wasPublished {
+		s.metrics.PostPublished()
+	}
+
+	post, err := s.GetByID(ctx, id)
+	if err != nil {
+		return Post{}, err
+	}
+
+	s.log.InfoContext(ctx, "post patched", "post_id", post.ID, "version", post.Version, "published", post.Published, "tags", len(post.Tags))
+	return post, nil
+}
+
+// patchTags applies a TagPatch to a post inside tx
+func (s *PostService) patchTags(ctx context.Context, tx *sql.Tx, postID string, patch TagPatch) error {
+	if patch.Set != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM post_tags WHERE post_id = $1`, postID); err != nil {
+			return err
+		}
+		_, err := linkTags(ctx, tx, postID, patch.Set)
+		return err
+	}
+
+	if len(patch.Remove) > 0 {
+		keys := make([]string, 0, len(patch.Remove))
+		for _, name := range patch.Remove {
+			keys = append(keys, tagKey(name))
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM post_tags
+			WHERE post_id = $1 AND tag_id IN (
+				SELECT id FROM tags WHERE lower(name) = ANY($2)
+				UNION
+				SELECT tag_id FROM tag_aliases WHERE alias = ANY($2)
+			)
+		`, postID, pq.Array(keys))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := linkTags(ctx, tx, postID, patch.Add)
+	return err
+}
+
+// linkTags attaches the named tags to a post, resolving aliases, creating
+// missing tags and ignoring tags the post already has. It returns the
+// canonical tags, without duplicates, in the order they were named.
+func linkTags(ctx context.Context, tx *sql.Tx, postID string, names []string) ([]Tag, error) {
+	resolved, err := upsertTags(ctx, tx, normalizeTagNames(names))
+	if err != nil {
+		return nil, err
+	}
+
+	// Two names may be aliases of the same tag
+	var tags []Tag
+	var tagIDs []string
+	linked := make(map[string]bool, len(resolved))
+	for _, tag := range resolved {
+		if linked[tag.ID] {
+			continue
+		}
+		linked[tag.ID] = true
+		tags = append(tags, tag)
+		tagIDs = append(tagIDs, tag.ID)
+	}
+	if len(tagIDs) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO post_tags (post_id, tag_id)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING
+	`, postID, pq.Array(tagIDs))
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// readTimeFor estimates reading time in minutes at 200 words per minute
+func readTimeFor(content string) int {
+	readTime := len(strings.Fields(content)) / 200
+	if readTime == 0 {
+		readTime = 1
+	}
+	return readTime
+}
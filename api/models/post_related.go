@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/biboy/blog/api/cache"
+)
+
+// Weights of the two signals in a related post's score; both signals are
+// normalized to [0, 1], so scores are too
+const (
+	relatedTagWeight  = 0.7
+	relatedTextWeight = 0.3
+)
+
+// RelatedPost is a published post recommended after reading another one
+type RelatedPost struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Excerpt   string    `json:"excerpt"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"createdAt"`
+	Score     float64   `json:"score"`
+}
+
+// GetRelated retrieves up to limit published posts most similar to the
+// post with the given ID, best first; it returns sql.ErrNoRows when that
+// post does not exist
+func (s *PostService) GetRelated(ctx context.Context, id string, limit int) ([]RelatedPost, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetRelated")
+	defer span.End()
+
+	return cache.Load(ctx, s.cache, postRelatedKey(id, limit), s.ttl.RelatedTTL, func(ctx context.Context) ([]RelatedPost, error) {
+		return s.loadRelated(ctx, id, limit)
+	})
+}
+
+// loadRelated scores every other published post against the given one.
+// Shared tags count by their inverse document frequency, so a rare tag
+// says more than one on half the blog, relative to the weight of all of
+// the post's tags. Text similarity is the Jaccard index of the stemmed
+// words in the title and excerpt.
+func (s *PostService) loadRelated(ctx context.Context, id string, limit int) ([]RelatedPost, error) {
+	var exists bool
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT true FROM posts WHERE id = $1 AND deleted_at IS NULL
+	`, id).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `
+		WITH published AS (
+			SELECT id, title, excerpt, slug, created_at,
+				tsvector_to_array(to_tsvector('english', title || ' ' || excerpt)) AS words
+			FROM posts
+			WHERE published AND deleted_at IS NULL
+		),
+		target AS (
+			SELECT id, tsvector_to_array(to_tsvector('english', title || ' ' || excerpt)) AS words
+			FROM posts
+			WHERE id = $1
+		),
+		tag_weights AS (
+			SELECT pt.tag_id, ln(1 + (SELECT count(*) FROM published)::float8 / count(*)) AS weight
+			FROM post_tags pt
+			JOIN published p ON p.id = pt.post_id
+			GROUP BY pt.tag_id
+		),
+		target_tags AS (
+			SELECT w.tag_id, w.weight
+			FROM post_tags pt
+			JOIN tag_weights w ON w.tag_id = pt.tag_id
+			WHERE pt.post_id = $1
+		),
+		tag_scores AS (
+			SELECT pt.post_id, sum(tt.weight) / (SELECT sum(weight) FROM target_tags) AS score
+			FROM post_tags pt
+			JOIN target_tags tt ON tt.tag_id = pt.tag_id
+			GROUP BY pt.post_id
+		),
+		scored AS (
+			SELECT p.id, p.title, p.excerpt, p.slug, p.created_at,
+				COALESCE(ts.score, 0) AS tag_score,
+				COALESCE(
+					(SELECT count(*) FROM (SELECT unnest(p.words) INTERSECT SELECT unnest(t.words)) shared)::float8 /
+					NULLIF((SELECT count(*) FROM (SELECT unnest(p.words) UNION SELECT unnest(t.words)) combined), 0),
+					0
+				) AS text_score
+			FROM published p
+			CROSS JOIN target t
+			LEFT JOIN tag_scores ts ON ts.post_id = p.id
+			WHERE p.id <> t.id
+		)
+		SELECT id, title, excerpt, slug, created_at,
+			round(($2 * tag_score + $3 * text_score)::numeric, 4)::float8 AS score
+		FROM scored
+		WHERE tag_score > 0 OR text_score > 0
+		ORDER BY score DESC, created_at DESC
+		LIMIT $4
+	`, id, relatedTagWeight, relatedTextWeight, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	related := []RelatedPost{}
+	for rows.Next() {
+		var post RelatedPost
+		if err := rows.Scan(&post.ID, &post.Title, &post.Excerpt, &post.Slug, &post.CreatedAt, &post.Score); err != nil {
+			return nil, err
+		}
+		related = append(related, post)
+	}
+
+	return related, rows.Err()
+}
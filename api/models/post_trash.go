@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ListTrashed retrieves posts in the trash, most recently deleted first
+func (s *PostService) ListTrashed(ctx context.Context, page, limit int) ([]Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.ListTrashed")
+	defer span.End()
+
+	offset := (page - 1) * limit
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT
+			p.id, p.title, p.excerpt, p.slug, p.published, p.read_time,
+			p.created_at, p.updated_at, p.version, p.deleted_at,
+			u.id, u.email, u.name, u.picture, u.is_admin,
+			c.id, c.name, c.slug
+		FROM posts p
+		JOIN users u ON u.id = p.author_id
+		LEFT JOIN categories c ON c.id = p.category_id
+		WHERE p.deleted_at IS NOT NULL
+		ORDER BY p.deleted_at DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var post Post
+		var categoryID, categoryName, categorySlug sql.NullString
+		if err := rows.Scan(
+			&post.ID, &post.Title, &post.Excerpt, &post.Slug, &post.Published, &post.ReadTime,
+			&post.CreatedAt, &post.UpdatedAt, &post.Version, &post.DeletedAt,
+			&post.Author.ID, &post.Author.Email, &post.Author.Name, &post.Author.Picture, &post.Author.IsAdmin,
+			&categoryID, &categoryName, &categorySlug,
+		); err != nil {
+			return nil, err
+		}
+		post.Category = categoryRefFrom(categoryID, categoryName, categorySlug)
+
+		tags, err := s.getTagsForPost(ctx, post.ID)
+		if err != nil {
+			return nil, err
+		}
+		post.Tags = tags
+
+		authors, err := s.getAuthorsForPost(ctx, post.ID, post.Author)
+		if err != nil {
+			return nil, err
+		}
+		post.Authors = authors
+
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// SlugTakenError reports the live post that took a trashed post's slug,
+// so that it can be renamed or the restore given another slug. It matches
+// ErrPostSlugTaken with errors.Is.
+type SlugTakenError struct {
+	Slug   string
+	PostID string
+	Title  string
+}
+
+// Error implements the error interface
+func (e *SlugTakenError) Error() string {
+	return fmt.Sprintf("slug %q is already used by post %s", e.Slug, e.PostID)
+}
+
+// Is reports whether target is ErrPostSlugTaken
+func (e *SlugTakenError) Is(target error) bool {
+	return target == ErrPostSlugTaken
+}
+
+// Restore moves a post out of the trash together with its comments and
+// tags, under slug when it is not empty and under its old slug otherwise.
+// It returns sql.ErrNoRows when the post is not in the trash and a
+// *SlugTakenError when a live post uses the slug.
+func (s *PostService) Restore(ctx context.Context, id, slug string) (Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.Restore")
+	defer span.End()
+
+	var restored string
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE posts SET deleted_at = NULL, slug = COALESCE(NULLIF($2, ''), slug)
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING slug
+	`, id, slug).Scan(&restored)
+	if err != nil {
+		if err = postSlugConflict(err); errors.Is(err, ErrPostSlugTaken) {
+			return Post{}, s.slugHolder(ctx, id, slug)
+		}
+		return Post{}, err
+	}
+
+	s.cache.InvalidatePrefix(ctx, postPagePrefix)
+	s.cache.InvalidatePrefix(ctx, postRelatedPrefix)
+	s.cache.Invalidate(ctx, postSlugKey(restored), tagCountsKey, archiveKey)
+	s.invalidateSeriesOf(ctx, id)
+
+	s.log.InfoContext(ctx, "post restored", "post_id", id, "slug", restored)
+	return s.GetByID(ctx, id)
+}
+
+// slugHolder describes the live post using the slug a trashed post could
+// not be restored under, falling back to ErrPostSlugTaken when that post
+// was removed in the meantime
+func (s *PostService) slugHolder(ctx context.Context, id, slug string) error {
+	conflict := &SlugTakenError{}
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT p.slug, p.id, p.title
+		FROM posts p
+		WHERE p.slug = COALESCE(NULLIF($2, ''), (SELECT slug FROM posts WHERE id = $1))
+			AND p.deleted_at IS NULL AND p.id <> $1
+	`, id, slug).Scan(&conflict.Slug, &conflict.PostID, &conflict.Title)
+	if err == sql.ErrNoRows {
+		return ErrPostSlugTaken
+	}
+	if err != nil {
+		return err
+	}
+	return conflict
+}
+
+// Purge permanently deletes a trashed post with its comments and tag
+// links; it returns sql.ErrNoRows when the post is not in the trash
+func (s *PostService) Purge(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "PostService.Purge")
+	defer span.End()
+
+	result, err := s.DB.ExecContext(ctx, `
+		DELETE FROM posts WHERE id = $1 AND deleted_at IS NOT NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if purged == 0 {
+		return sql.ErrNoRows
+	}
+
+	s.log.InfoContext(ctx, "post purged", "post_id", id)
+	return nil
+}
+
+// PurgeExpired permanently deletes posts that have been in the trash for
+// longer than retention and returns how many were removed
+func (s *PostService) PurgeExpired(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, span := tracer.Start(ctx, "PostService.PurgeExpired")
+	defer span.End()
+
+	result, err := s.DB.ExecContext(ctx, `
+		DELETE FROM posts WHERE deleted_at <= $1
+	`, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		s.log.InfoContext(ctx, "expired posts purged from trash", "count", purged)
+	}
+	return purged, nil
+}
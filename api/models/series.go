@@ -0,0 +1,481 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/biboy/blog/api/cache"
+)
+
+var (
+	// ErrSeriesSlugTaken is returned when a series slug is already in use
+	ErrSeriesSlugTaken = errors.New("series slug is already in use")
+	// ErrPostInOtherSeries is returned when a post already belongs to another series
+	ErrPostInOtherSeries = errors.New("post already belongs to another series")
+	// ErrSeriesPostNotFound is returned when a series member does not exist
+	ErrSeriesPostNotFound = errors.New("post not found")
+	// ErrDuplicateSeriesPost is returned when a post is listed twice or a
+	// post ID is empty
+	ErrDuplicateSeriesPost = errors.New("post IDs must be distinct and non-empty")
+)
+
+// Series is an ordered collection of posts, such as a multi-part tutorial
+type Series struct {
+	ID          string       `json:"id"`
+	Title       string       `json:"title"`
+	Slug        string       `json:"slug"`
+	Description string       `json:"description"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+	PostCount   int          `json:"postCount"`
+	Posts       []SeriesPost `json:"posts,omitempty"`
+}
+
+// SeriesPost is a member of a series in reading order
+type SeriesPost struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Slug      string    `json:"slug"`
+	Excerpt   string    `json:"excerpt"`
+	Published bool      `json:"published"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SeriesFormData represents the form data for creating/updating a series;
+// an empty slug is derived from the title on create and kept on update
+type SeriesFormData struct {
+	Title       string `json:"title"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+}
+
+// PostLink points at another post from a post page
+type PostLink struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Slug  string `json:"slug"`
+}
+
+// PostSeries places a post within its series; Part counts from 1 and
+// Previous and Next skip unpublished and trashed posts
+type PostSeries struct {
+	ID       string    `json:"id"`
+	Title    string    `json:"title"`
+	Slug     string    `json:"slug"`
+	Part     int       `json:"part"`
+	Parts    int       `json:"parts"`
+	Previous *PostLink `json:"previous"`
+	Next     *PostLink `json:"next"`
+}
+
+// SeriesService provides methods to interact with series in the database
+type SeriesService struct {
+	DB    *sql.DB
+	log   *slog.Logger
+	cache *cache.Loader
+}
+
+// NewSeriesService creates a new series service
+func NewSeriesService(db *sql.DB, logger *slog.Logger, loader *cache.Loader) *SeriesService {
+	return &SeriesService{DB: db, log: logger, cache: loader}
+}
+
+// GetAll retrieves every series with its number of published posts
+func (s *SeriesService) GetAll(ctx context.Context) ([]Series, error) {
+	ctx, span := tracer.Start(ctx, "SeriesService.GetAll")
+	defer span.End()
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT s.id, s.title, s.slug, s.description, s.created_at, s.updated_at, COUNT(p.id)
+		FROM series s
+		LEFT JOIN series_posts sp ON sp.series_id = s.id
+		LEFT JOIN posts p ON p.id = sp.post_id AND p.published AND p.deleted_at IS NULL
+		GROUP BY s.id
+		ORDER BY s.title ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []Series{}
+	for rows.Next() {
+		var item Series
+		if err := rows.Scan(
+			&item.ID, &item.Title, &item.Slug, &item.Description, &item.CreatedAt, &item.UpdatedAt, &item.PostCount,
+		); err != nil {
+			return nil, err
+		}
+		series = append(series, item)
+	}
+
+	return series, rows.Err()
+}
+
+// GetBySlug retrieves a series with its published posts in order
+func (s *SeriesService) GetBySlug(ctx context.Context, slug string) (Series, error) {
+	ctx, span := tracer.Start(ctx, "SeriesService.GetBySlug")
+	defer span.End()
+
+	var series Series
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, title, slug, description, created_at, updated_at
+		FROM series
+		WHERE slug = $1
+	`, slug).Scan(&series.ID, &series.Title, &series.Slug, &series.Description, &series.CreatedAt, &series.UpdatedAt)
+	if err != nil {
+		return series, err
+	}
+
+	series.Posts, err = s.getPosts(ctx, series.ID, true)
+	series.PostCount = len(series.Posts)
+	return series, err
+}
+
+// GetByID retrieves a series with all of its posts, including drafts
+func (s *SeriesService) GetByID(ctx context.Context, id string) (Series, error) {
+	ctx, span := tracer.Start(ctx, "SeriesService.GetByID")
+	defer span.End()
+
+	var series Series
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, title, slug, description, created_at, updated_at
+		FROM series
+		WHERE id = $1
+	`, id).Scan(&series.ID, &series.Title, &series.Slug, &series.Description, &series.CreatedAt, &series.UpdatedAt)
+	if err != nil {
+		return series, err
+	}
+
+	series.Posts, err = s.getPosts(ctx, series.ID, false)
+	series.PostCount = len(series.Posts)
+	return series, err
+}
+
+// getPosts lists the members of a series in order, optionally only the
+// published ones
+func (s *SeriesService) getPosts(ctx context.Context, seriesID string, publishedOnly bool) ([]SeriesPost, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT p.id, p.title, p.slug, p.excerpt, p.published, sp.position, p.created_at
+		FROM series_posts sp
+		JOIN posts p ON p.id = sp.post_id
+		WHERE sp.series_id = $1 AND p.deleted_at IS NULL AND (p.published OR NOT $2)
+		ORDER BY sp.position ASC
+	`, seriesID, publishedOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []SeriesPost{}
+	for rows.Next() {
+		var post SeriesPost
+		if err := rows.Scan(
+			&post.ID, &post.Title, &post.Slug, &post.Excerpt, &post.Published, &post.Position, &post.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// Create adds a new, empty series; it returns ErrSeriesSlugTaken when an
+// explicit slug is in use. A slug derived from the title is numbered
+// instead, as for tags and categories.
+func (s *SeriesService) Create(ctx context.Context, data SeriesFormData) (Series, error) {
+	ctx, span := tracer.Start(ctx, "SeriesService.Create")
+	defer span.End()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Series{}, err
+	}
+
+	if err := lockSlugs(ctx, tx, "series"); err != nil {
+		tx.Rollback()
+		return Series{}, err
+	}
+
+	slug := data.Slug
+	if slug == "" {
+		if slug, err = availableSlug(ctx, tx, "series", slugify(data.Title, "series")); err != nil {
+			tx.Rollback()
+			return Series{}, err
+		}
+	}
+
+	var series Series
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO series (id, title, slug, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING id, title, slug, description, created_at, updated_at
+	`, generateID(), data.Title, slug, data.Description, time.Now()).Scan(
+		&series.ID, &series.Title, &series.Slug, &series.Description, &series.CreatedAt, &series.UpdatedAt,
+	)
+	if err != nil {
+		tx.Rollback()
+		if isUniqueViolation(err) {
+			return series, ErrSeriesSlugTaken
+		}
+		return series, err
+	}
+	if err := tx.Commit(); err != nil {
+		return series, err
+	}
+
+	series.Posts = []SeriesPost{}
+	s.log.InfoContext(ctx, "series created", "series_id", series.ID, "slug", series.Slug)
+	return series, nil
+}
+
+// Update modifies a series' title, slug and description
+func (s *SeriesService) Update(ctx context.Context, id string, data SeriesFormData) (Series, error) {
+	ctx, span := tracer.Start(ctx, "SeriesService.Update")
+	defer span.End()
+
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE series
+		SET title = $1, slug = COALESCE(NULLIF($2, ''), slug), description = $3, updated_at = $4
+		WHERE id = $5
+	`, data.Title, data.Slug, data.Description, time.Now(), id)
+	if isUniqueViolation(err) {
+		return Series{}, ErrSeriesSlugTaken
+	}
+	if err != nil {
+		return Series{}, err
+	}
+
+	if err := s.invalidateMembers(ctx, id); err != nil {
+		return Series{}, err
+	}
+
+	s.log.InfoContext(ctx, "series updated", "series_id", id)
+	return s.GetByID(ctx, id)
+}
+
+// SetPosts replaces the members of a series with postIDs, in that order.
+// It returns ErrDuplicateSeriesPost for repeated or empty IDs,
+// ErrSeriesPostNotFound for unknown posts and ErrPostInOtherSeries for
+// posts that belong to another series.
+func (s *SeriesService) SetPosts(ctx context.Context, id string, postIDs []string) (Series, error) {
+	ctx, span := tracer.Start(ctx, "SeriesService.SetPosts")
+	defer span.End()
+
+	// A repeated post would otherwise violate the same unique constraint
+	// as a post from another series
+	seen := make(map[string]bool, len(postIDs))
+	for _, postID := range postIDs {
+		if postID == "" || seen[postID] {
+			return Series{}, ErrDuplicateSeriesPost
+		}
+		seen[postID] = true
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Series{}, err
+	}
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT true FROM series WHERE id = $1 FOR UPDATE`, id).Scan(&exists)
+	if err != nil {
+		tx.Rollback()
+		return Series{}, err
+	}
+
+	// Former members must drop their navigation too
+	keys, err := seriesMemberKeys(ctx, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return Series{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM series_posts WHERE series_id = $1`, id); err != nil {
+		tx.Rollback()
+		return Series{}, err
+	}
+
+	if len(postIDs) > 0 {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO series_posts (series_id, post_id, position)
+			SELECT $1, m.post_id, m.position
+			FROM unnest($2::text[]) WITH ORDINALITY AS m(post_id, position)
+		`, id, pq.Array(postIDs))
+		if err != nil {
+			tx.Rollback()
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) {
+				switch {
+				case pqErr.Code == "23505" && pqErr.Constraint == "series_posts_post_id_key":
+					return Series{}, ErrPostInOtherSeries
+				case pqErr.Code == "23503":
+					return Series{}, ErrSeriesPostNotFound
+				}
+			}
+			return Series{}, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE series SET updated_at = $1 WHERE id = $2`, time.Now(), id); err != nil {
+		tx.Rollback()
+		return Series{}, err
+	}
+
+	newKeys, err := seriesMemberKeys(ctx, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return Series{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Series{}, err
+	}
+
+	s.cache.Invalidate(ctx, append(keys, newKeys...)...)
+
+	s.log.InfoContext(ctx, "series posts set", "series_id", id, "posts", len(postIDs))
+	return s.GetByID(ctx, id)
+}
+
+// Delete removes a series; its posts remain as standalone posts
+func (s *SeriesService) Delete(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "SeriesService.Delete")
+	defer span.End()
+
+	// Invalidate before the cascade removes the memberships
+	if err := s.invalidateMembers(ctx, id); err != nil {
+		return err
+	}
+
+	result, err := s.DB.ExecContext(ctx, `DELETE FROM series WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	s.log.InfoContext(ctx, "series deleted", "series_id", id)
+	return nil
+}
+
+// invalidateMembers drops every cached post of a series
+func (s *SeriesService) invalidateMembers(ctx context.Context, id string) error {
+	keys, err := seriesMemberKeys(ctx, s.DB, id)
+	if err != nil {
+		return err
+	}
+	s.cache.Invalidate(ctx, keys...)
+	return nil
+}
+
+// rowsQueryer is satisfied by both *sql.DB and *sql.Tx
+type rowsQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// seriesMemberKeys returns the cache keys of every post in a series
+func seriesMemberKeys(ctx context.Context, q rowsQueryer, seriesID string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT p.slug
+		FROM series_posts sp
+		JOIN posts p ON p.id = sp.post_id
+		WHERE sp.series_id = $1
+	`, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		keys = append(keys, postSlugKey(slug))
+	}
+
+	return keys, rows.Err()
+}
+
+// getSeriesForPost places a post within its series, or returns nil when it
+// belongs to none
+func (s *PostService) getSeriesForPost(ctx context.Context, postID string) (*PostSeries, error) {
+	ctx, span := tracer.Start(ctx, "PostService.getSeriesForPost")
+	defer span.End()
+
+	var series PostSeries
+	var prevID, prevTitle, prevSlug, nextID, nextTitle, nextSlug sql.NullString
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT s.id, s.title, s.slug, m.part, m.parts,
+			m.prev_id, m.prev_title, m.prev_slug, m.next_id, m.next_title, m.next_slug
+		FROM (
+			SELECT sp.series_id, sp.post_id,
+				row_number() OVER w AS part,
+				count(*) OVER (PARTITION BY sp.series_id) AS parts,
+				lag(p.id) OVER w AS prev_id, lag(p.title) OVER w AS prev_title, lag(p.slug) OVER w AS prev_slug,
+				lead(p.id) OVER w AS next_id, lead(p.title) OVER w AS next_title, lead(p.slug) OVER w AS next_slug
+			FROM series_posts sp
+			JOIN posts p ON p.id = sp.post_id
+			WHERE sp.series_id = (SELECT series_id FROM series_posts WHERE post_id = $1)
+				AND ((p.published AND p.deleted_at IS NULL) OR p.id = $1)
+			WINDOW w AS (PARTITION BY sp.series_id ORDER BY sp.position)
+		) m
+		JOIN series s ON s.id = m.series_id
+		WHERE m.post_id = $1
+	`, postID).Scan(
+		&series.ID, &series.Title, &series.Slug, &series.Part, &series.Parts,
+		&prevID, &prevTitle, &prevSlug, &nextID, &nextTitle, &nextSlug,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if prevID.Valid {
+		series.Previous = &PostLink{ID: prevID.String, Title: prevTitle.String, Slug: prevSlug.String}
+	}
+	if nextID.Valid {
+		series.Next = &PostLink{ID: nextID.String, Title: nextTitle.String, Slug: nextSlug.String}
+	}
+	return &series, nil
+}
+
+// invalidateSeriesOf drops the cached posts in the same series as postID,
+// whose navigation embeds its title, slug and visibility. The write has
+// already committed, so failures are logged rather than returned.
+func (s *PostService) invalidateSeriesOf(ctx context.Context, postID string) {
+	var seriesID string
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT series_id FROM series_posts WHERE post_id = $1
+	`, postID).Scan(&seriesID)
+	if err == sql.ErrNoRows {
+		return
+	}
+
+	var keys []string
+	if err == nil {
+		keys, err = seriesMemberKeys(ctx, s.DB, seriesID)
+	}
+	if err != nil {
+		s.log.WarnContext(ctx, "failed to invalidate series navigation", "post_id", postID, "error", err)
+		return
+	}
+	s.cache.Invalidate(ctx, keys...)
+}
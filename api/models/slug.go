@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ValidSlug reports whether slug is lower-case words joined by hyphens
+func ValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}
+
+// NormalizeName trims the name of a tag or category and collapses internal
+// whitespace
+func NormalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// slugify derives a URL slug from a name, e.g. "Machine Learning"
+// becomes "machine-learning", or returns fallback when the name has no
+// letters or digits
+func slugify(name, fallback string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else if b.Len() > 0 && !strings.HasSuffix(b.String(), "-") {
+			b.WriteByte('-')
+		}
+	}
+
+	slug := strings.TrimSuffix(b.String(), "-")
+	if slug == "" {
+		return fallback
+	}
+	return slug
+}
+
+// lockSlugs serializes transactions that allocate slugs in table until tx
+// ends, so that concurrent writers number colliding slugs instead of
+// violating the unique constraint. table must be a constant such as "tags".
+func lockSlugs(ctx context.Context, tx *sql.Tx, table string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, table+".slug")
+	return err
+}
+
+// takenSlugs returns the slugs rows of table already use that base or a
+// numbered form of base could collide with. table must be a constant such
+// as "tags", never user input.
+func takenSlugs(ctx context.Context, q rowsQueryer, table, base string) (map[string]bool, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT slug FROM `+table+` WHERE slug = $1 OR slug LIKE $1 || '-%'
+	`, base)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		taken[slug] = true
+	}
+	return taken, rows.Err()
+}
+
+// numberedSlug returns base, or base with the smallest numeric suffix from
+// 2 up that is not taken
+func numberedSlug(base string, taken map[string]bool) string {
+	slug := base
+	for n := 2; taken[slug]; n++ {
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+	return slug
+}
+
+// availableSlug returns base, or base with the smallest numeric suffix
+// that no row of table uses yet
+func availableSlug(ctx context.Context, q rowsQueryer, table, base string) (string, error) {
+	taken, err := takenSlugs(ctx, q, table, base)
+	if err != nil {
+		return "", err
+	}
+	return numberedSlug(base, taken), nil
+}
@@ -1,29 +1,83 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
 )
 
+// ErrTagNameTaken is returned when a tag name or alias already belongs to
+// another tag, ignoring case
+var ErrTagNameTaken = errors.New("tag name is already in use")
+
+// ErrTagSlugTaken is returned when a tag slug already belongs to another tag
+var ErrTagSlugTaken = errors.New("tag slug is already in use")
+
 // Tag represents a blog post tag
 type Tag struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Slug        string   `json:"slug"`
+	Description string   `json:"description"`
+	Color       string   `json:"color"`
+	Aliases     []string `json:"aliases,omitempty"`
+	PostCount   *int     `json:"postCount,omitempty"`
+}
+
+// TagFormData represents the form data for creating/updating a tag; an
+// empty slug is derived from the name on create and kept on update
+type TagFormData struct {
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	Color       string `json:"color"`
+}
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ValidTagColor reports whether color is empty or a #rrggbb hex color
+func ValidTagColor(color string) bool {
+	return color == "" || tagColorPattern.MatchString(color)
+}
+
+// tagKey is the case-insensitive form of a tag name used for matching
+func tagKey(name string) string {
+	return strings.ToLower(NormalizeName(name))
 }
 
 // TagService provides methods to interact with tags in the database
 type TagService struct {
-	DB *sql.DB
+	DB    *sql.DB
+	log   *slog.Logger
+	cache *cache.Loader
+	ttl   config.CacheConfig
 }
 
 // NewTagService creates a new tag service
-func NewTagService(db *sql.DB) *TagService {
-	return &TagService{DB: db}
+func NewTagService(db *sql.DB, logger *slog.Logger, loader *cache.Loader, ttl config.CacheConfig) *TagService {
+	return &TagService{DB: db, log: logger, cache: loader, ttl: ttl}
 }
 
 // GetAll retrieves all tags
-func (s *TagService) GetAll() ([]Tag, error) {
-	rows, err := s.DB.Query(`
-		SELECT id, name
+func (s *TagService) GetAll(ctx context.Context) ([]Tag, error) {
+	ctx, span := tracer.Start(ctx, "TagService.GetAll")
+	defer span.End()
+
+	return cache.Load(ctx, s.cache, tagsKey, s.ttl.TagsTTL, s.loadAll)
+}
+
+// loadAll reads every tag from the database
+func (s *TagService) loadAll(ctx context.Context) ([]Tag, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, name, slug, description, color
 		FROM tags
 		ORDER BY name ASC
 	`)
@@ -36,7 +90,7 @@ func (s *TagService) GetAll() ([]Tag, error) {
 	var tags []Tag
 	for rows.Next() {
 		var tag Tag
-		if err := rows.Scan(&tag.ID, &tag.Name); err != nil {
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Description, &tag.Color); err != nil {
 			return nil, err
 		}
 		tags = append(tags, tag)
@@ -45,61 +99,419 @@ func (s *TagService) GetAll() ([]Tag, error) {
 	return tags, rows.Err()
 }
 
+// GetAllWithCounts retrieves all tags with the number of published posts
+// carrying each
+func (s *TagService) GetAllWithCounts(ctx context.Context) ([]Tag, error) {
+	ctx, span := tracer.Start(ctx, "TagService.GetAllWithCounts")
+	defer span.End()
+
+	return cache.Load(ctx, s.cache, tagCountsKey, s.ttl.TagsTTL, s.loadAllWithCounts)
+}
+
+// loadAllWithCounts reads every tag and its published post count from the database
+func (s *TagService) loadAllWithCounts(ctx context.Context) ([]Tag, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT t.id, t.name, t.slug, t.description, t.color, COUNT(p.id)
+		FROM tags t
+		LEFT JOIN post_tags pt ON pt.tag_id = t.id
+		LEFT JOIN posts p ON p.id = pt.post_id AND p.published AND p.deleted_at IS NULL
+		GROUP BY t.id
+		ORDER BY t.name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		var count int
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Description, &tag.Color, &count); err != nil {
+			return nil, err
+		}
+		tag.PostCount = &count
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
 // GetByID retrieves a tag by its ID
-func (s *TagService) GetByID(id string) (Tag, error) {
+func (s *TagService) GetByID(ctx context.Context, id string) (Tag, error) {
+	ctx, span := tracer.Start(ctx, "TagService.GetByID")
+	defer span.End()
+
 	var tag Tag
-	err := s.DB.QueryRow(`
-		SELECT id, name
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, name, slug, description, color
 		FROM tags
 		WHERE id = $1
-	`, id).Scan(&tag.ID, &tag.Name)
+	`, id).Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Description, &tag.Color)
+	if err != nil {
+		return tag, err
+	}
 
+	tag.Aliases, err = s.getAliases(ctx, tag.ID)
 	return tag, err
 }
 
-// GetByName retrieves a tag by its name
-func (s *TagService) GetByName(name string) (Tag, error) {
+// GetBySlug retrieves a tag by its slug
+func (s *TagService) GetBySlug(ctx context.Context, slug string) (Tag, error) {
+	ctx, span := tracer.Start(ctx, "TagService.GetBySlug")
+	defer span.End()
+
 	var tag Tag
-	err := s.DB.QueryRow(`
-		SELECT id, name
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, name, slug, description, color
 		FROM tags
-		WHERE name = $1
-	`, name).Scan(&tag.ID, &tag.Name)
+		WHERE slug = $1
+	`, slug).Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Description, &tag.Color)
+	return tag, err
+}
+
+// GetByName retrieves a tag by its name or one of its aliases, ignoring case
+func (s *TagService) GetByName(ctx context.Context, name string) (Tag, error) {
+	ctx, span := tracer.Start(ctx, "TagService.GetByName")
+	defer span.End()
+
+	tag, err := lookupTag(ctx, s.DB, name)
+	if err != nil {
+		return tag, err
+	}
 
+	tag.Aliases, err = s.getAliases(ctx, tag.ID)
 	return tag, err
 }
 
-// Create adds a new tag
-func (s *TagService) Create(name string) (Tag, error) {
+// Create adds a new tag; it returns ErrTagNameTaken when the name matches
+// an existing tag or alias and ErrTagSlugTaken when the slug is in use
+func (s *TagService) Create(ctx context.Context, data TagFormData) (Tag, error) {
+	ctx, span := tracer.Start(ctx, "TagService.Create")
+	defer span.End()
+
+	name := NormalizeName(data.Name)
+	if _, err := lookupTag(ctx, s.DB, name); err != sql.ErrNoRows {
+		if err == nil {
+			err = ErrTagNameTaken
+		}
+		return Tag{}, err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	if err := lockSlugs(ctx, tx, "tags"); err != nil {
+		tx.Rollback()
+		return Tag{}, err
+	}
+
+	slug := data.Slug
+	if slug == "" {
+		if slug, err = availableSlug(ctx, tx, "tags", slugify(name, "tag")); err != nil {
+			tx.Rollback()
+			return Tag{}, err
+		}
+	}
+
 	tagID := generateID()
 
 	var tag Tag
-	err := s.DB.QueryRow(`
-		INSERT INTO tags (id, name)
-		VALUES ($1, $2)
-		RETURNING id, name
-	`, tagID, name).Scan(&tag.ID, &tag.Name)
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO tags (id, name, slug, description, color)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, name, slug, description, color
+	`, tagID, name, slug, data.Description, data.Color).Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Description, &tag.Color)
+	if err != nil {
+		tx.Rollback()
+		return tag, tagConflict(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return tag, tagConflict(err)
+	}
 
-	return tag, err
+	s.cache.Invalidate(ctx, tagsKey, tagCountsKey)
+
+	s.log.InfoContext(ctx, "tag created", "tag_id", tag.ID, "name", tag.Name, "slug", tag.Slug)
+	return tag, nil
 }
 
-// Update modifies an existing tag
-func (s *TagService) Update(id string, name string) (Tag, error) {
+// Update modifies an existing tag; it returns ErrTagNameTaken when the name
+// matches another tag or an alias and ErrTagSlugTaken when the slug is in
+// use. Changing only the case of the name is allowed.
+func (s *TagService) Update(ctx context.Context, id string, data TagFormData) (Tag, error) {
+	ctx, span := tracer.Start(ctx, "TagService.Update")
+	defer span.End()
+
+	name := NormalizeName(data.Name)
+	existing, err := lookupTag(ctx, s.DB, name)
+	if err == nil && existing.ID != id {
+		return Tag{}, ErrTagNameTaken
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return Tag{}, err
+	}
+
+	// An empty slug keeps the current one so that tag links stay stable
 	var tag Tag
-	err := s.DB.QueryRow(`
+	err = s.DB.QueryRowContext(ctx, `
 		UPDATE tags
-		SET name = $1
-		WHERE id = $2
-		RETURNING id, name
-	`, name, id).Scan(&tag.ID, &tag.Name)
+		SET name = $1, slug = COALESCE(NULLIF($2, ''), slug), description = $3, color = $4
+		WHERE id = $5
+		RETURNING id, name, slug, description, color
+	`, name, data.Slug, data.Description, data.Color, id).Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Description, &tag.Color)
+	if err != nil {
+		return tag, tagConflict(err)
+	}
 
-	return tag, err
+	if err := s.invalidatePostsWithTag(ctx, tag.ID); err != nil {
+		return tag, err
+	}
+
+	s.log.InfoContext(ctx, "tag updated", "tag_id", tag.ID, "name", tag.Name, "slug", tag.Slug)
+	return tag, nil
 }
 
 // Delete removes a tag
-func (s *TagService) Delete(id string) error {
-	_, err := s.DB.Exec(`
+func (s *TagService) Delete(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "TagService.Delete")
+	defer span.End()
+
+	// Invalidate before the cascade removes the links that identify the posts
+	if err := s.invalidatePostsWithTag(ctx, id); err != nil {
+		return err
+	}
+
+	_, err := s.DB.ExecContext(ctx, `
 		DELETE FROM tags WHERE id = $1
 	`, id)
-	return err
+	if err != nil {
+		return err
+	}
+
+	s.log.InfoContext(ctx, "tag deleted", "tag_id", id)
+	return nil
+}
+
+// PruneOrphans deletes tags that no post uses, including trashed posts,
+// and returns how many were removed
+func (s *TagService) PruneOrphans(ctx context.Context) (int64, error) {
+	ctx, span := tracer.Start(ctx, "TagService.PruneOrphans")
+	defer span.End()
+
+	result, err := s.DB.ExecContext(ctx, `
+		DELETE FROM tags t
+		WHERE NOT EXISTS (SELECT 1 FROM post_tags pt WHERE pt.tag_id = t.id)
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if pruned > 0 {
+		s.cache.Invalidate(ctx, tagsKey, tagCountsKey)
+	}
+
+	s.log.InfoContext(ctx, "orphaned tags pruned", "count", pruned)
+	return pruned, nil
+}
+
+// invalidatePostsWithTag drops the cached tag list and every cached post
+// that embeds the tag
+func (s *TagService) invalidatePostsWithTag(ctx context.Context, tagID string) error {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT p.slug
+		FROM posts p
+		JOIN post_tags pt ON p.id = pt.post_id
+		WHERE pt.tag_id = $1
+	`, tagID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := []string{tagsKey, tagCountsKey}
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return err
+		}
+		keys = append(keys, postSlugKey(slug))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) > 2 {
+		s.cache.InvalidatePrefix(ctx, postPagePrefix)
+		s.cache.InvalidatePrefix(ctx, postRelatedPrefix)
+	}
+	s.cache.Invalidate(ctx, keys...)
+	return nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// lookupTag finds the tag a name refers to, matching tag names and aliases
+// case-insensitively
+func lookupTag(ctx context.Context, q queryer, name string) (Tag, error) {
+	var tag Tag
+	err := q.QueryRowContext(ctx, `
+		SELECT t.id, t.name, t.slug, t.description, t.color FROM tags t WHERE lower(t.name) = $1
+		UNION ALL
+		SELECT t.id, t.name, t.slug, t.description, t.color FROM tag_aliases a JOIN tags t ON t.id = a.tag_id WHERE a.alias = $1
+		LIMIT 1
+	`, tagKey(name)).Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Description, &tag.Color)
+	return tag, err
+}
+
+// upsertTags resolves names to their canonical tags, following aliases and
+// creating missing tags. names must already be
+// normalized and free of case-insensitive duplicates. Conflicting inserts
+// update the existing row so that tags created by concurrent transactions
+// are returned too, and new tags are inserted in name order so concurrent
+// saves lock them in the same order. Tags are returned in the order named.
+func upsertTags(ctx context.Context, tx *sql.Tx, names []string) ([]Tag, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	missing, err := missingTagNames(ctx, tx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	// New tags get a numbered slug when theirs is taken. Slugs are picked
+	// under a lock so that parallel saves adding names with the same slug,
+	// such as "C" and "C++", number them instead of colliding.
+	slugs := make([]string, len(names))
+	if len(missing) > 0 {
+		if err := lockSlugs(ctx, tx, "tags"); err != nil {
+			return nil, err
+		}
+
+		assigned := make(map[string]bool, len(missing))
+		for i, name := range names {
+			if !missing[name] {
+				continue
+			}
+			base := slugify(name, "tag")
+			taken, err := takenSlugs(ctx, tx, "tags", base)
+			if err != nil {
+				return nil, err
+			}
+			for slug := range assigned {
+				taken[slug] = true
+			}
+			slugs[i] = numberedSlug(base, taken)
+			assigned[slugs[i]] = true
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		WITH names AS (
+			SELECT n.name, n.slug, n.ord, a.tag_id
+			FROM unnest($1::text[], $3::text[]) WITH ORDINALITY AS n(name, slug, ord)
+			LEFT JOIN tag_aliases a ON a.alias = lower(n.name)
+		),
+		upserted AS (
+			INSERT INTO tags (id, name, slug)
+			SELECT $2::text || '_' || n.ord, n.name, n.slug
+			FROM names n
+			WHERE n.tag_id IS NULL
+			ORDER BY lower(n.name)
+			ON CONFLICT ((lower(name))) DO UPDATE SET name = tags.name
+			RETURNING id, name, slug, description, color
+		)
+		SELECT
+			COALESCE(t.id, u.id), COALESCE(t.name, u.name), COALESCE(t.slug, u.slug),
+			COALESCE(t.description, u.description), COALESCE(t.color, u.color)
+		FROM names n
+		LEFT JOIN tags t ON t.id = n.tag_id
+		LEFT JOIN upserted u ON lower(u.name) = lower(n.name)
+		ORDER BY n.ord
+	`, pq.Array(names), generateID(), pq.Array(slugs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]Tag, 0, len(names))
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Description, &tag.Color); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// missingTagNames returns the names that match neither a tag nor an alias
+func missingTagNames(ctx context.Context, q rowsQueryer, names []string) (map[string]bool, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT n.name
+		FROM unnest($1::text[]) AS n(name)
+		WHERE NOT EXISTS (SELECT 1 FROM tags t WHERE lower(t.name) = lower(n.name))
+			AND NOT EXISTS (SELECT 1 FROM tag_aliases a WHERE a.alias = lower(n.name))
+	`, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	missing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		missing[name] = true
+	}
+	return missing, rows.Err()
+}
+
+// normalizeTagNames normalizes names, dropping blanks and case-insensitive
+// duplicates while keeping the first spelling of each
+func normalizeTagNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var normalized []string
+	for _, name := range names {
+		name = NormalizeName(name)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		normalized = append(normalized, name)
+	}
+	return normalized
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// tagConflict maps unique violations on tags to ErrTagNameTaken or
+// ErrTagSlugTaken and returns other errors unchanged
+func tagConflict(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return err
+	}
+	if pqErr.Constraint == "tags_slug_key" {
+		return ErrTagSlugTaken
+	}
+	return ErrTagNameTaken
 }
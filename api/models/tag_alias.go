@@ -0,0 +1,219 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// ErrTagMergeSelf is returned when a tag is merged into itself
+var ErrTagMergeSelf = errors.New("cannot merge a tag into itself")
+
+// getAliases lists the aliases that resolve to a tag
+func (s *TagService) getAliases(ctx context.Context, tagID string) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT alias FROM tag_aliases WHERE tag_id = $1 ORDER BY alias
+	`, tagID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []string
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, rows.Err()
+}
+
+// AddAlias makes alias resolve to a tag, so posts tagged with it get the
+// tag instead. It returns sql.ErrNoRows when the tag does not exist and
+// ErrTagNameTaken when alias already names a tag or alias.
+func (s *TagService) AddAlias(ctx context.Context, tagID, alias string) (Tag, error) {
+	ctx, span := tracer.Start(ctx, "TagService.AddAlias")
+	defer span.End()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT true FROM tags WHERE id = $1 FOR UPDATE
+	`, tagID).Scan(&exists)
+	if err != nil {
+		tx.Rollback()
+		return Tag{}, err
+	}
+
+	if _, err := lookupTag(ctx, tx, alias); err != sql.ErrNoRows {
+		tx.Rollback()
+		if err == nil {
+			err = ErrTagNameTaken
+		}
+		return Tag{}, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO tag_aliases (alias, tag_id) VALUES ($1, $2)
+	`, tagKey(alias), tagID)
+	if err != nil {
+		tx.Rollback()
+		if isUniqueViolation(err) {
+			err = ErrTagNameTaken
+		}
+		return Tag{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Tag{}, err
+	}
+
+	s.log.InfoContext(ctx, "tag alias added", "tag_id", tagID, "alias", tagKey(alias))
+	return s.GetByID(ctx, tagID)
+}
+
+// RemoveAlias stops alias from resolving to a tag; it returns
+// sql.ErrNoRows when the tag has no such alias
+func (s *TagService) RemoveAlias(ctx context.Context, tagID, alias string) error {
+	ctx, span := tracer.Start(ctx, "TagService.RemoveAlias")
+	defer span.End()
+
+	result, err := s.DB.ExecContext(ctx, `
+		DELETE FROM tag_aliases WHERE alias = $1 AND tag_id = $2
+	`, tagKey(alias), tagID)
+	if err != nil {
+		return err
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return sql.ErrNoRows
+	}
+
+	s.log.InfoContext(ctx, "tag alias removed", "tag_id", tagID, "alias", tagKey(alias))
+	return nil
+}
+
+// Merge moves every post and alias from the source tag to the target tag
+// and deletes the source, whose name becomes an alias of the target. It
+// returns sql.ErrNoRows when either tag does not exist.
+func (s *TagService) Merge(ctx context.Context, sourceID, targetID string) (Tag, error) {
+	ctx, span := tracer.Start(ctx, "TagService.Merge")
+	defer span.End()
+
+	if sourceID == targetID {
+		return Tag{}, ErrTagMergeSelf
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	// Lock both tags in a fixed order so concurrent merges cannot deadlock
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, name FROM tags WHERE id = ANY($1) ORDER BY id FOR UPDATE
+	`, pq.Array([]string{sourceID, targetID}))
+	if err != nil {
+		tx.Rollback()
+		return Tag{}, err
+	}
+	var source Tag
+	found := 0
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return Tag{}, err
+		}
+		if tag.ID == sourceID {
+			source = tag
+		}
+		found++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return Tag{}, err
+	}
+	if found != 2 {
+		tx.Rollback()
+		return Tag{}, sql.ErrNoRows
+	}
+
+	// Remember which cached posts embed the source tag before relinking them
+	slugs, err := tx.QueryContext(ctx, `
+		SELECT p.slug
+		FROM posts p
+		JOIN post_tags pt ON p.id = pt.post_id
+		WHERE pt.tag_id = $1
+	`, sourceID)
+	if err != nil {
+		tx.Rollback()
+		return Tag{}, err
+	}
+	keys := []string{tagsKey, tagCountsKey}
+	for slugs.Next() {
+		var slug string
+		if err := slugs.Scan(&slug); err != nil {
+			slugs.Close()
+			tx.Rollback()
+			return Tag{}, err
+		}
+		keys = append(keys, postSlugKey(slug))
+	}
+	slugs.Close()
+	if err := slugs.Err(); err != nil {
+		tx.Rollback()
+		return Tag{}, err
+	}
+
+	statements := []string{
+		`INSERT INTO post_tags (post_id, tag_id)
+		SELECT post_id, $2 FROM post_tags WHERE tag_id = $1
+		ON CONFLICT DO NOTHING`,
+		`UPDATE tag_aliases SET tag_id = $2 WHERE tag_id = $1`,
+		`DELETE FROM tags WHERE id = $1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, sourceID, targetID); err != nil {
+			tx.Rollback()
+			return Tag{}, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO tag_aliases (alias, tag_id) VALUES ($1, $2)
+		ON CONFLICT (alias) DO UPDATE SET tag_id = EXCLUDED.tag_id
+	`, tagKey(source.Name), targetID)
+	if err != nil {
+		tx.Rollback()
+		return Tag{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Tag{}, err
+	}
+
+	if len(keys) > 2 {
+		s.cache.InvalidatePrefix(ctx, postPagePrefix)
+		s.cache.InvalidatePrefix(ctx, postRelatedPrefix)
+	}
+	s.cache.Invalidate(ctx, keys...)
+
+	s.log.InfoContext(ctx, "tags merged", "source_id", sourceID, "target_id", targetID, "posts", len(keys)-2)
+	return s.GetByID(ctx, targetID)
+}
@@ -0,0 +1,133 @@
+package models_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/biboy/blog/api/cache"
+	"github.com/biboy/blog/api/config"
+	"github.com/biboy/blog/api/db"
+	"github.com/biboy/blog/api/metrics"
+	"github.com/biboy/blog/api/models"
+)
+
+// openTestDB connects to the database in TEST_DATABASE_URL and migrates it,
+// skipping the test when it is not set
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.Default().Database
+	cfg.URL = url
+
+	database, err := db.Connect(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if err := db.InitSchema(database, logger); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func TestCreatePostsWithCollidingTagsInParallel(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	posts := models.NewPostService(database, logger, metrics.New(database), cache.NewLoader(cache.Noop{}), config.Default().Cache)
+
+	// Every name slugifies to the same slug, and two differ only in case
+	run := fmt.Sprintf("t%d", time.Now().UnixNano())
+	names := []string{"Lang " + run, "Lang++ " + run, "Lang# " + run, "LANG " + run, "Lang! " + run}
+	author := models.Author{ID: "user_" + run, Name: "Tag Tester", Email: run + "@example.com"}
+
+	t.Cleanup(func() {
+		database.Exec(`DELETE FROM posts WHERE author_id = $1`, author.ID)
+		database.Exec(`DELETE FROM tags WHERE lower(name) LIKE '%' || $1`, run)
+		database.Exec(`DELETE FROM users WHERE id = $1`, author.ID)
+	})
+
+	const saves = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, saves)
+	for i := 0; i < saves; i++ {
+		// Rotate the names so saves insert them in different orders
+		tags := append(append([]string{}, names[i%len(names):]...), names[:i%len(names)]...)
+
+		wg.Add(1)
+		go func(i int, tags []string) {
+			defer wg.Done()
+			_, err := posts.Create(ctx, models.PostFormData{
+				Title:   fmt.Sprintf("Parallel %d", i),
+				Content: "Saved in parallel",
+				Slug:    fmt.Sprintf("parallel-%s-%d", run, i),
+				Tags:    tags,
+			}, author)
+			if err != nil {
+				errs <- fmt.Errorf("save %d: %w", i, err)
+			}
+		}(i, tags)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	rows, err := database.Query(`SELECT lower(name), slug FROM tags WHERE lower(name) LIKE '%' || $1`, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	tagsByName := map[string]int{}
+	slugs := map[string]bool{}
+	for rows.Next() {
+		var name, slug string
+		if err := rows.Scan(&name, &slug); err != nil {
+			t.Fatal(err)
+		}
+		tagsByName[name]++
+		if slugs[slug] {
+			t.Errorf("slug %q is used twice", slug)
+		}
+		slugs[slug] = true
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// "Lang" and "LANG" are one tag
+	if len(tagsByName) != len(names)-1 {
+		t.Errorf("got %d tags, want %d: %v", len(tagsByName), len(names)-1, tagsByName)
+	}
+	for name, count := range tagsByName {
+		if count != 1 {
+			t.Errorf("tag %q exists %d times", name, count)
+		}
+	}
+
+	base := "lang-" + strings.ToLower(run)
+	for slug := range slugs {
+		if slug != base && !strings.HasPrefix(slug, base+"-") {
+			t.Errorf("slug %q is not %q numbered", slug, base)
+		}
+	}
+}
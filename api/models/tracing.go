@@ -0,0 +1,9 @@
+package models
+
+import (
+	"go.opentelemetry.io/otel"
+)
+
+// tracer creates a span per service call; the instrumented driver adds a
+// child span for every SQL statement issued with the same context
+var tracer = otel.Tracer("github.com/biboy/blog/api/models")
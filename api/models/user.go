@@ -0,0 +1,51 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/biboy/blog/api/cache"
+)
+
+// upsertUser records the name and avatar an author signed in with, keyed
+// by their identity provider subject, and returns the stored profile. It
+// reports whether an existing profile changed, in which case every cached
+// post they wrote or commented on is stale. The admin flag is never taken
+// from the request: new users start without it and only the database
+// grants it.
+func upsertUser(ctx context.Context, tx *sql.Tx, author Author) (Author, bool, error) {
+	// xmax is only set on rows the conflict branch updated, and the WHERE
+	// clause skips updates that would not change anything
+	var changed bool
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO users (id, email, name, picture, is_admin, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, false, $5, $5)
+		ON CONFLICT (id) DO UPDATE
+		SET name = EXCLUDED.name, picture = EXCLUDED.picture, updated_at = EXCLUDED.updated_at
+		WHERE (users.name, users.picture) IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.picture)
+		RETURNING xmax <> 0
+	`, author.ID, author.Email, author.Name, author.Picture, time.Now()).Scan(&changed)
+	if err != nil && err != sql.ErrNoRows {
+		return Author{}, false, err
+	}
+
+	stored, err := getUser(ctx, tx, author.ID)
+	return stored, changed, err
+}
+
+// getUser reads an author's current profile
+func getUser(ctx context.Context, q queryer, id string) (Author, error) {
+	var author Author
+	err := q.QueryRowContext(ctx, `
+		SELECT id, email, name, picture, is_admin FROM users WHERE id = $1
+	`, id).Scan(&author.ID, &author.Email, &author.Name, &author.Picture, &author.IsAdmin)
+	return author, err
+}
+
+// invalidateProfiles drops every cached post, since posts embed the
+// current profiles of their author and commenters
+func invalidateProfiles(ctx context.Context, loader *cache.Loader) {
+	loader.InvalidatePrefix(ctx, postPagePrefix)
+	loader.InvalidatePrefix(ctx, postSlugPrefix)
+}
@@ -0,0 +1,30 @@
+// Package storage keeps uploaded media files.
+//
+// Handlers depend on the Storage interface so that files can live on the
+// local disk in development and in an S3-compatible bucket in production.
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrNotFound is returned when deleting a file that does not exist
+var ErrNotFound = errors.New("storage: file not found")
+
+// Storage stores files under slash-separated keys such as
+// "2024/03/abc123.png"
+type Storage interface {
+	// Put stores data under key, replacing any existing file
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Delete removes the file stored under key
+	Delete(ctx context.Context, key string) error
+	// URL returns the public URL of the file stored under key
+	URL(key string) string
+}
+
+// joinURL appends key to a base URL or path without doubling slashes
+func joinURL(base, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(key, "/")
+}
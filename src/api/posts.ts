@@ -144,16 +144,28 @@ export const createPost = async (
   }
 };
 
-// Update an existing post
+// Thrown by updatePost when someone else saved the post first
+export class PostConflictError extends Error {
+  current: Post;
+
+  constructor(current: Post) {
+    super("Post has been modified by someone else");
+    this.current = current;
+  }
+}
+
+// Update an existing post; version is the one the editor started from
 export const updatePost = async (
   id: string,
-  postData: Partial<PostFormData>
+  postData: Partial<PostFormData>,
+  version: number
 ): Promise<Post | null> => {
   try {
     const response = await fetch(`${API_CONFIG.baseUrl}/posts/${id}`, {
       method: "PUT",
       headers: {
         "Content-Type": "application/json",
+        "If-Match": `"v${version}"`,
       },
       body: JSON.stringify(postData),
     });
@@ -162,6 +174,10 @@ export const updatePost = async (
       if (response.status === 404) {
         return null;
       }
+      if (response.status === 412) {
+        const { current } = await response.json();
+        throw new PostConflictError(current);
+      }
       throw new Error(`Error updating post: ${response.statusText}`);
     }
 
@@ -176,6 +192,9 @@ export const updatePost = async (
 
     return updatedPost;
   } catch (error) {
+    if (error instanceof PostConflictError) {
+      throw error;
+    }
     console.error("Error updating post:", error);
     return null;
   }
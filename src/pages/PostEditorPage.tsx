@@ -1,7 +1,12 @@
 import { useState, useEffect } from "react";
 import { useParams, useNavigate } from "react-router-dom";
 import { useForm } from "react-hook-form";
-import { getPostById, createPost, updatePost } from "../api/posts";
+import {
+  getPostById,
+  createPost,
+  updatePost,
+  PostConflictError,
+} from "../api/posts";
 import { PostFormData } from "../types";
 import { useAuth } from "../context/AuthContext";
 import MarkdownEditor from "../components/MarkdownEditor";
@@ -14,6 +19,7 @@ export default function PostEditorPage() {
   const [tagInput, setTagInput] = useState("");
   const [tags, setTags] = useState<string[]>([]);
   const [content, setContent] = useState("");
+  const [version, setVersion] = useState(0);
 
   const {
     register,
@@ -32,7 +38,8 @@ export default function PostEditorPage() {
       return;
     }
 
-    if (user && !user.isAdmin) {
+    // Co-authors may edit their posts, but only admins create new ones
+    if (user && !user.isAdmin && !isEditMode) {
       navigate("/");
       return;
     }
@@ -43,6 +50,15 @@ export default function PostEditorPage() {
       setIsLoading(true);
       try {
         const post = await getPostById(id as string);
+        if (
+          post &&
+          user &&
+          !user.isAdmin &&
+          !post.authors?.some((author) => author.id === user.id)
+        ) {
+          navigate("/");
+          return;
+        }
         if (post) {
           setValue("title", post.title);
           setValue("excerpt", post.excerpt);
@@ -50,6 +66,7 @@ export default function PostEditorPage() {
           setValue("published", post.published);
           setContent(post.content ?? "");
           setTags(post.tags.map((tag) => tag.name));
+          setVersion(post.version);
         }
       } catch (error) {
         console.error("Failed to fetch post:", error);
@@ -85,7 +102,7 @@ export default function PostEditorPage() {
 
     try {
       if (isEditMode) {
-        await updatePost(id as string, postData);
+        await updatePost(id as string, postData, version);
         navigate(`/posts/${data.slug}`);
       } else {
         const newPost = await createPost(postData, user);
@@ -99,6 +116,15 @@ export default function PostEditorPage() {
         }
       }
     } catch (error) {
+      if (error instanceof PostConflictError) {
+        // Keep the user's edits and let them save over the newer version
+        setVersion(error.current.version);
+        alert(
+          "This post was changed by someone else while you were editing. " +
+            "Save again to overwrite their changes."
+        );
+        return;
+      }
       console.error("Failed to save post:", error);
     } finally {
       setIsLoading(false);
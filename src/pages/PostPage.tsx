@@ -85,6 +85,11 @@ export default function PostPage() {
     );
   }
 
+  // Admins and everyone in the author list may edit the post
+  const canEdit =
+    !!user &&
+    (user.isAdmin || !!post.authors?.some((author) => author.id === user.id));
+
   return (
     <div className="container mx-auto py-8">
       <article className="max-w-4xl mx-auto bg-white dark:bg-[rgb(46,46,51)] rounded-lg shadow-md overflow-hidden">
@@ -98,7 +103,8 @@ export default function PostPage() {
               />
               <div>
                 <p className="font-medium text-gray-900 dark:text-white">
-                  {post.author.name}
+                  {post.authors?.map((author) => author.name).join(", ") ??
+                    post.author.name}
                 </p>
                 <p className="text-sm text-gray-500 dark:text-gray-400">
                   {format(new Date(post.createdAt), "MMMM d, yyyy")}
@@ -106,7 +112,7 @@ export default function PostPage() {
               </div>
             </div>
 
-            {user?.isAdmin && (
+            {canEdit && (
               <div className="flex space-x-2">
                 <Link
                   to={`/admin/edit/${post.id}`}
@@ -114,12 +120,14 @@ export default function PostPage() {
                 >
                   Edit
                 </Link>
-                <button
-                  onClick={handleDelete}
-                  className="bg-red-600 text-white px-4 py-2 rounded-md text-sm hover:bg-red-700 focus:outline-none focus:ring-2 focus:ring-red-500 focus:ring-offset-2"
-                >
-                  Delete
-                </button>
+                {user?.isAdmin && (
+                  <button
+                    onClick={handleDelete}
+                    className="bg-red-600 text-white px-4 py-2 rounded-md text-sm hover:bg-red-700 focus:outline-none focus:ring-2 focus:ring-red-500 focus:ring-offset-2"
+                  >
+                    Delete
+                  </button>
+                )}
               </div>
             )}
           </div>
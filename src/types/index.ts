@@ -16,14 +16,100 @@ export interface Post {
   readTime?: number;
   createdAt: string;
   updatedAt: string;
+  version: number;
+  category?: CategoryRef | null;
+  series?: PostSeries;
+  adjacent?: AdjacentPosts;
   author: User;
+  authors?: PostAuthor[];
   tags: Tag[];
   comments: Comment[];
 }
 
+export interface PostAuthor {
+  id: string;
+  name: string;
+  picture: string;
+  role: string;
+}
+
+export interface AuthorProfile {
+  id: string;
+  name: string;
+  picture: string;
+  bio: string;
+  links: Record<string, string>;
+  postCount: number;
+  commentCount: number;
+}
+
+export interface Media {
+  id: string;
+  url: string;
+  filename: string;
+  contentType: string;
+  size: number;
+  width: number;
+  height: number;
+  uploaderId: string;
+  createdAt: string;
+  usageCount: number;
+}
+
+export interface CategoryRef {
+  id: string;
+  name: string;
+  slug: string;
+}
+
+export interface ArchiveMonth {
+  month: number;
+  count: number;
+}
+
+export interface ArchiveYear {
+  year: number;
+  count: number;
+  months: ArchiveMonth[];
+}
+
+export interface RelatedPost {
+  id: string;
+  title: string;
+  excerpt: string;
+  slug: string;
+  createdAt: string;
+  score: number;
+}
+
+export interface PostLink {
+  id: string;
+  title: string;
+  slug: string;
+}
+
+export interface AdjacentPosts {
+  older: PostLink | null;
+  newer: PostLink | null;
+}
+
+export interface PostSeries {
+  id: string;
+  title: string;
+  slug: string;
+  part: number;
+  parts: number;
+  previous: PostLink | null;
+  next: PostLink | null;
+}
+
 export interface Tag {
   id: string;
   name: string;
+  slug: string;
+  description: string;
+  color: string;
+  postCount?: number;
 }
 
 export interface Comment {